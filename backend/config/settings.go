@@ -0,0 +1,140 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OrderNumbering controls how CreateInvoice allocates order numbers. Each
+// branch keeps its own counter; with DailyReset the counter restarts every
+// day and the date becomes part of the number so numbers stay unique.
+type OrderNumbering struct {
+	Branch     string
+	Prefix     string
+	DailyReset bool
+	Start      int
+}
+
+var OrderNumbers OrderNumbering
+
+// ShopDetails is printed at the top of receipts.
+type ShopDetails struct {
+	Name     string
+	Address  string
+	Phone    string
+	Currency string
+}
+
+var Shop ShopDetails
+
+// Printers maps a print target ("receipt" or "kitchen") to its printer,
+// either tcp://host:port for a network printer or a file or device path.
+// Targets without a printer are left out.
+var Printers map[string]string
+
+// TokenSecret signs staff login tokens and TokenTTL is how long they last.
+var (
+	TokenSecret []byte
+	TokenTTL    time.Duration
+)
+
+// Anyone who knows the token secret can sign themselves in as any staff
+// member, so it must be set, long, and not one that has been published.
+const minTokenSecretLength = 32
+
+var publishedTokenSecrets = map[string]bool{"change-me-to-a-long-random-string": true}
+
+// Till sessions lock after TillIdleTimeout without a request. After
+// PINAttempts wrong PINs in a row a staff member can't log in with their PIN
+// for PINLockout.
+var (
+	TillIdleTimeout time.Duration
+	PINAttempts     int
+	PINLockout      time.Duration
+)
+
+// WebhookAttempts is how many times a webhook delivery is tried before it
+// fails.
+var WebhookAttempts int
+
+// KitchenStations maps an item category to the kitchen display station that
+// prepares it. Categories without a station aren't sent to the kitchen.
+var KitchenStations map[string]string
+
+// PrintAttempts is how many times a print job is tried before it fails.
+var PrintAttempts int
+
+// InitSettings reads application settings from the environment. It must run
+// after InitDB, which loads the .env file.
+func InitSettings() {
+	OrderNumbers = OrderNumbering{
+		Branch:     GetEnv("BRANCH_CODE", "main"),
+		Prefix:     GetEnv("ORDER_NO_PREFIX", ""),
+		DailyReset: getEnvBool("ORDER_NO_DAILY_RESET", false),
+		Start:      getEnvInt("ORDER_NO_START", 10000),
+	}
+
+	Shop = ShopDetails{
+		Name:     GetEnv("SHOP_NAME", "PIZZA SHOP"),
+		Address:  GetEnv("SHOP_ADDRESS", "123 Pizza Street, Food City"),
+		Phone:    GetEnv("SHOP_PHONE", "(123) 456-7890"),
+		Currency: GetEnv("SHOP_CURRENCY", "Rs"),
+	}
+
+	Printers = make(map[string]string)
+	for target, key := range map[string]string{"receipt": "PRINTER_RECEIPT", "kitchen": "PRINTER_KITCHEN"} {
+		if address := GetEnv(key, ""); address != "" {
+			Printers[target] = address
+		}
+	}
+	PrintAttempts = getEnvInt("PRINT_ATTEMPTS", 5)
+
+	WebhookAttempts = getEnvInt("WEBHOOK_ATTEMPTS", 8)
+
+	secret := GetEnv("JWT_SECRET", "")
+	if len(secret) < minTokenSecretLength || publishedTokenSecrets[secret] {
+		log.Fatalf("JWT_SECRET must be set to a random string of at least %d characters; see backend/.env.example", minTokenSecretLength)
+	}
+	TokenSecret = []byte(secret)
+	TokenTTL = time.Duration(getEnvInt("TOKEN_TTL_HOURS", 12)) * time.Hour
+
+	TillIdleTimeout = time.Duration(getEnvInt("TILL_IDLE_MINUTES", 5)) * time.Minute
+	PINAttempts = getEnvInt("PIN_ATTEMPTS", 5)
+	PINLockout = time.Duration(getEnvInt("PIN_LOCKOUT_MINUTES", 15)) * time.Minute
+
+	KitchenStations = make(map[string]string)
+	for _, pair := range strings.Split(GetEnv("KDS_STATIONS", "pizza=pizza,beverage=bar"), ",") {
+		category, station, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || category == "" || station == "" {
+			log.Fatalf("Invalid KDS_STATIONS entry %q, expected category=station", pair)
+		}
+		KitchenStations[category] = station
+	}
+}
+
+// GetEnv returns the environment variable or fallback when it is unset.
+func GetEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(GetEnv(key, strconv.FormatBool(fallback)))
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return value
+}
+
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(GetEnv(key, strconv.Itoa(fallback)))
+	if err != nil {
+		log.Fatalf("Invalid %s: %v", key, err)
+	}
+	return value
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"pizza-shop/models"
+	"pizza-shop/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditController struct {
+	auditService services.AuditService
+}
+
+func NewAuditController() *AuditController {
+	return &AuditController{
+		auditService: services.AuditService{},
+	}
+}
+
+// GetAuditLog lists audit entries, newest first. Query parameters:
+//
+//	limit                  page size (default 50, max 200)
+//	cursor                 next_cursor from the previous page
+//	from, to               date range, as YYYY-MM-DD (inclusive) or RFC 3339
+//	actor_id               changes made by a staff member
+//	action                 e.g. item.pizza_price_updated
+//	entity_type, entity_id the changed record, e.g. item and 12
+func (c *AuditController) GetAuditLog(ctx *gin.Context) {
+	filter, err := parseAuditFilter(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := c.auditService.GetAuditLog(filter)
+	if err != nil {
+		respondWithError(ctx, err, "Audit entry not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, page)
+}
+
+func parseAuditFilter(ctx *gin.Context) (models.AuditFilter, error) {
+	filter := models.AuditFilter{
+		Action:     ctx.Query("action"),
+		EntityType: ctx.Query("entity_type"),
+		Cursor:     ctx.Query("cursor"),
+		Limit:      50,
+	}
+
+	var err error
+	if value := ctx.Query("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit < 1 || filter.Limit > 200 {
+			return filter, fmt.Errorf("limit must be between 1 and 200")
+		}
+	}
+	if filter.From, err = parseDateParam(ctx, "from", false); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseDateParam(ctx, "to", true); err != nil {
+		return filter, err
+	}
+	if filter.ActorID, err = parseIDParam(ctx, "actor_id"); err != nil {
+		return filter, err
+	}
+	if filter.EntityID, err = parseIDParam(ctx, "entity_id"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
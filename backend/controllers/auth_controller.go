@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"net/http"
+	"pizza-shop/middleware"
+	"pizza-shop/models"
+	"pizza-shop/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthController struct {
+	staffService services.StaffService
+}
+
+func NewAuthController() *AuthController {
+	return &AuthController{
+		staffService: services.StaffService{},
+	}
+}
+
+func (c *AuthController) Login(ctx *gin.Context) {
+	var input models.LoginInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := c.staffService.Login(input)
+	if err != nil {
+		respondWithError(ctx, err, "Staff member not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, session)
+}
+
+// Me returns the logged in staff member.
+func (c *AuthController) Me(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, middleware.CurrentStaff(ctx))
+}
@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"pizza-shop/middleware"
+	"pizza-shop/models"
+	"pizza-shop/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CashDrawerController struct {
+	cashDrawerService services.CashDrawerService
+}
+
+func NewCashDrawerController() *CashDrawerController {
+	return &CashDrawerController{
+		cashDrawerService: services.CashDrawerService{},
+	}
+}
+
+// currentDrawerID finds the drawer of the caller's till session. It writes
+// the error response and returns false if there isn't one.
+func (c *CashDrawerController) currentDrawerID(ctx *gin.Context) (int, bool) {
+	till := middleware.CurrentTillSession(ctx)
+	if till == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Not logged in on a till"})
+		return 0, false
+	}
+
+	id, err := c.cashDrawerService.GetTillSessionDrawerID(till.ID)
+	if err == sql.ErrNoRows {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "No cash drawer has been opened on this till"})
+		return 0, false
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return 0, false
+	}
+	return id, true
+}
+
+// GetCurrentCashDrawer returns the caller's drawer. Its totals are left out
+// until it is closed so the count is blind.
+func (c *CashDrawerController) GetCurrentCashDrawer(ctx *gin.Context) {
+	id, ok := c.currentDrawerID(ctx)
+	if !ok {
+		return
+	}
+
+	drawer, err := c.cashDrawerService.GetCashDrawer(id, true)
+	if err != nil {
+		respondWithError(ctx, err, "Cash drawer not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, drawer)
+}
+
+func (c *CashDrawerController) OpenCashDrawer(ctx *gin.Context) {
+	till := middleware.CurrentTillSession(ctx)
+	if till == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Not logged in on a till"})
+		return
+	}
+
+	var input models.OpenCashDrawerInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	drawer, err := c.cashDrawerService.OpenCashDrawer(till.ID, input)
+	if err != nil {
+		respondWithError(ctx, err, "Cash drawer not found")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, drawer)
+}
+
+func (c *CashDrawerController) AddCurrentCashMovement(ctx *gin.Context) {
+	if id, ok := c.currentDrawerID(ctx); ok {
+		c.addCashMovement(ctx, id)
+	}
+}
+
+func (c *CashDrawerController) CloseCurrentCashDrawer(ctx *gin.Context) {
+	if id, ok := c.currentDrawerID(ctx); ok {
+		c.closeCashDrawer(ctx, id)
+	}
+}
+
+// GetCashDrawers lists drawers. Query parameters: status (open or closed)
+// and from, to for when they were opened.
+func (c *CashDrawerController) GetCashDrawers(ctx *gin.Context) {
+	from, err := parseDateParam(ctx, "from", false)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseDateParam(ctx, "to", true)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	drawers, err := c.cashDrawerService.GetCashDrawers(ctx.Query("status"), from, to)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, drawers)
+}
+
+// GetCashDrawer returns a drawer with what it should hold, for managers.
+func (c *CashDrawerController) GetCashDrawer(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cash drawer ID"})
+		return
+	}
+
+	drawer, err := c.cashDrawerService.GetCashDrawer(id, false)
+	if err != nil {
+		respondWithError(ctx, err, "Cash drawer not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, drawer)
+}
+
+func (c *CashDrawerController) AddCashMovement(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cash drawer ID"})
+		return
+	}
+	c.addCashMovement(ctx, id)
+}
+
+// CloseCashDrawer lets a manager count a drawer, e.g. when its cashier has
+// gone home.
+func (c *CashDrawerController) CloseCashDrawer(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cash drawer ID"})
+		return
+	}
+	c.closeCashDrawer(ctx, id)
+}
+
+func (c *CashDrawerController) addCashMovement(ctx *gin.Context, drawerID int) {
+	var input models.CreateCashMovementInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	movement, err := c.cashDrawerService.AddCashMovement(drawerID, input, middleware.CurrentStaff(ctx).ID)
+	if err != nil {
+		respondWithError(ctx, err, "Cash drawer not found")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, movement)
+}
+
+func (c *CashDrawerController) closeCashDrawer(ctx *gin.Context, drawerID int) {
+	var input models.CloseCashDrawerInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	drawer, err := c.cashDrawerService.CloseCashDrawer(drawerID, input, middleware.CurrentStaff(ctx).Name)
+	if err != nil {
+		respondWithError(ctx, err, "Cash drawer not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, drawer)
+}
@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"pizza-shop/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondWithError maps the errors returned by services to HTTP responses.
+// notFound is the message used when the requested record doesn't exist.
+func respondWithError(ctx *gin.Context, err error, notFound string) {
+	var (
+		validationErr *services.ValidationError
+		transitionErr *services.InvalidTransitionError
+		conflictErr   *services.ConflictError
+	)
+	switch {
+	case errors.As(err, &validationErr):
+		ctx.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Invalid request", "details": validationErr.Problems})
+	case errors.As(err, &transitionErr), errors.As(err, &conflictErr), err == services.ErrOrderNoConflict:
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err == services.ErrInvalidCredentials, err == services.ErrTillSessionLocked:
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case err == services.ErrPINLockedOut:
+		ctx.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case err == services.ErrPrintQueueFull:
+		ctx.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case err == sql.ErrNoRows:
+		ctx.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	default:
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
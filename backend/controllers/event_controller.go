@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"pizza-shop/events"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamHeartbeat is how often event streams send something even when
+// nothing has happened, so clients and proxies keep the connection open.
+const streamHeartbeat = 15 * time.Second
+
+type EventController struct{}
+
+func NewEventController() *EventController {
+	return &EventController{}
+}
+
+// startEventStream sets the headers for a Server-Sent Events response.
+func startEventStream(ctx *gin.Context) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+}
+
+func writeEvent(w io.Writer, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// StreamEvents is a Server-Sent Events stream of changes. Query parameters:
+// topics, a comma-separated list of topics (item, topping, invoice, kds) or
+// event types, default all. Clients resume with the Last-Event-ID header,
+// which browsers send when they reconnect, or the last_event_id parameter. If
+// events since then have been lost the stream starts with a "reset" event
+// and the client should reload what it shows.
+func (c *EventController) StreamEvents(ctx *gin.Context) {
+	var topics []string
+	if param := ctx.Query("topics"); param != "" {
+		topics = strings.Split(param, ",")
+	}
+
+	lastEventID := ctx.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = ctx.Query("last_event_id")
+	}
+	var after uint64
+	if lastEventID != "" {
+		var err error
+		after, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID"})
+			return
+		}
+	}
+
+	sub, missed, complete := events.Subscribe(topics, after)
+	defer sub.Close()
+
+	startEventStream(ctx)
+	if !complete {
+		ctx.SSEvent("reset", gin.H{"message": "Some events were missed; reload before applying new ones"})
+	}
+	for _, event := range missed {
+		if err := writeEvent(ctx.Writer, event); err != nil {
+			return
+		}
+	}
+	ctx.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-sub.C:
+			// A closed channel means this client fell behind; it will
+			// reconnect and catch up from its last event
+			if !ok {
+				return false
+			}
+			return writeEvent(w, event) == nil
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": heartbeat\n\n")
+			return err == nil
+		case <-ctx.Request.Context().Done():
+			return false
+		}
+	})
+}
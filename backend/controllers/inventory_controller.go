@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"net/http"
+	"pizza-shop/middleware"
+	"pizza-shop/models"
+	"pizza-shop/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InventoryController struct {
+	inventoryService services.InventoryService
+}
+
+func NewInventoryController() *InventoryController {
+	return &InventoryController{
+		inventoryService: services.InventoryService{},
+	}
+}
+
+// GetIngredients lists ingredients; ?low_stock=true lists only those at or
+// below their low-stock threshold.
+func (c *InventoryController) GetIngredients(ctx *gin.Context) {
+	lowStock, _ := strconv.ParseBool(ctx.Query("low_stock"))
+
+	ingredients, err := c.inventoryService.GetIngredients(lowStock)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ingredients)
+}
+
+func (c *InventoryController) CreateIngredient(ctx *gin.Context) {
+	var input models.CreateIngredientInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ingredient, err := c.inventoryService.CreateIngredient(input, middleware.CurrentActor(ctx))
+	if err != nil {
+		respondWithError(ctx, err, "Ingredient not found")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, ingredient)
+}
+
+func (c *InventoryController) UpdateIngredient(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ingredient ID"})
+		return
+	}
+
+	var input models.UpdateIngredientInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ingredient, err := c.inventoryService.UpdateIngredient(id, input, middleware.CurrentActor(ctx))
+	if err != nil {
+		respondWithError(ctx, err, "Ingredient not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ingredient)
+}
+
+func (c *InventoryController) AdjustStock(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ingredient ID"})
+		return
+	}
+
+	var input models.AdjustStockInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ingredient, err := c.inventoryService.AdjustStock(id, input, middleware.CurrentActor(ctx))
+	if err != nil {
+		respondWithError(ctx, err, "Ingredient not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ingredient)
+}
+
+func (c *InventoryController) GetItemRecipe(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	recipe, err := c.inventoryService.GetItemRecipe(id)
+	if err != nil {
+		respondWithError(ctx, err, "Item not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, recipe)
+}
+
+func (c *InventoryController) SetItemRecipe(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	var input models.SetRecipeInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipe, err := c.inventoryService.SetItemRecipe(id, input, middleware.CurrentActor(ctx))
+	if err != nil {
+		respondWithError(ctx, err, "Item not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, recipe)
+}
+
+func (c *InventoryController) GetToppingRecipe(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid topping ID"})
+		return
+	}
+
+	recipe, err := c.inventoryService.GetToppingRecipe(id)
+	if err != nil {
+		respondWithError(ctx, err, "Topping not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, recipe)
+}
+
+func (c *InventoryController) SetToppingRecipe(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid topping ID"})
+		return
+	}
+
+	var input models.SetRecipeInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recipe, err := c.inventoryService.SetToppingRecipe(id, input, middleware.CurrentActor(ctx))
+	if err != nil {
+		respondWithError(ctx, err, "Topping not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, recipe)
+}
+
+// GetStockShortages lists the items and toppings that can't be made from
+// the ingredients in stock.
+func (c *InventoryController) GetStockShortages(ctx *gin.Context) {
+	shortages, err := c.inventoryService.GetStockShortages()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, shortages)
+}
@@ -1,10 +1,16 @@
 package controllers
 
 import (
+	"bytes"
+	"fmt"
 	"net/http"
+	"pizza-shop/export"
+	"pizza-shop/middleware"
 	"pizza-shop/models"
+	"pizza-shop/receipt"
 	"pizza-shop/services"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -25,10 +31,14 @@ func (c *InvoiceController) CreateInvoice(ctx *gin.Context) {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	input.CashierID = &middleware.CurrentStaff(ctx).ID
+	if till := middleware.CurrentTillSession(ctx); till != nil {
+		input.TerminalID = &till.TerminalID
+	}
 
-	invoice, err := c.invoiceService.CreateInvoice(input)
+	invoice, err := c.invoiceService.CreateInvoice(input, middleware.CurrentActor(ctx))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(ctx, err, "Invoice not found")
 		return
 	}
 
@@ -44,7 +54,7 @@ func (c *InvoiceController) GetInvoice(ctx *gin.Context) {
 
 	invoice, err := c.invoiceService.GetInvoice(id)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondWithError(ctx, err, "Invoice not found")
 		return
 	}
 
@@ -61,16 +71,120 @@ func (c *InvoiceController) GetLatestOrderNo(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"order_no": orderNo})
 }
 
+// GetAllInvoices lists invoices a page at a time. Query parameters:
+//
+//	page, limit          page number (from 1) and page size (default 50, max 200)
+//	cursor               next_cursor from the previous page, instead of page
+//	from, to             date range, as YYYY-MM-DD (inclusive) or RFC 3339
+//	status, order_no     exact matches
+//	min_total, max_total bounds on total_amount
+//	item_name            invoices containing a matching line
+//	cashier_id           rung up by a staff member
+//	terminal_id          rung up on a till
 func (c *InvoiceController) GetAllInvoices(ctx *gin.Context) {
-	invoices, err := c.invoiceService.GetAllInvoices()
+	filter, err := parseInvoiceFilter(ctx)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invoices, err := c.invoiceService.GetAllInvoices(filter)
+	if err != nil {
+		respondWithError(ctx, err, "Invoice not found")
 		return
 	}
 
 	ctx.JSON(http.StatusOK, invoices)
 }
 
+func parseInvoiceFilter(ctx *gin.Context) (models.InvoiceFilter, error) {
+	filter := models.InvoiceFilter{
+		Status:   ctx.Query("status"),
+		OrderNo:  ctx.Query("order_no"),
+		ItemName: ctx.Query("item_name"),
+		Cursor:   ctx.Query("cursor"),
+		Page:     1,
+		Limit:    50,
+	}
+
+	var err error
+	if value := ctx.Query("page"); value != "" {
+		if filter.Page, err = strconv.Atoi(value); err != nil || filter.Page < 1 {
+			return filter, fmt.Errorf("invalid page %q", value)
+		}
+	}
+	if value := ctx.Query("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil || filter.Limit < 1 || filter.Limit > 200 {
+			return filter, fmt.Errorf("limit must be between 1 and 200")
+		}
+	}
+	if filter.From, err = parseDateParam(ctx, "from", false); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseDateParam(ctx, "to", true); err != nil {
+		return filter, err
+	}
+	if filter.CashierID, err = parseIDParam(ctx, "cashier_id"); err != nil {
+		return filter, err
+	}
+	if filter.TerminalID, err = parseIDParam(ctx, "terminal_id"); err != nil {
+		return filter, err
+	}
+	if filter.MinTotal, err = parseMoneyParam(ctx, "min_total"); err != nil {
+		return filter, err
+	}
+	if filter.MaxTotal, err = parseMoneyParam(ctx, "max_total"); err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+// parseDateParam reads a YYYY-MM-DD or RFC 3339 query parameter. A plain
+// date used as an upper bound covers the whole day, so it is returned as
+// the start of the next day.
+func parseDateParam(ctx *gin.Context, name string, endOfDay bool) (*time.Time, error) {
+	value := ctx.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q, expected YYYY-MM-DD", name, value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+func parseMoneyParam(ctx *gin.Context, name string) (*models.Money, error) {
+	value := ctx.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := models.ParseMoney(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return &amount, nil
+}
+
+func parseIDParam(ctx *gin.Context, name string) (*int, error) {
+	value := ctx.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q", name, value)
+	}
+	return &id, nil
+}
+
 func (c *InvoiceController) GetInvoiceItems(ctx *gin.Context) {
 	invoiceID, err := strconv.Atoi(ctx.Param("id"))
 	if err != nil {
@@ -86,3 +200,241 @@ func (c *InvoiceController) GetInvoiceItems(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, items)
 }
+
+func (c *InvoiceController) UpdateStatus(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	var input models.UpdateInvoiceStatusInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invoice, err := c.invoiceService.UpdateStatus(id, input.Status, middleware.CurrentActor(ctx))
+	if err != nil {
+		respondWithError(ctx, err, "Invoice not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, invoice)
+}
+
+func (c *InvoiceController) VoidInvoice(ctx *gin.Context) {
+	c.createCreditNote(ctx, c.invoiceService.VoidInvoice)
+}
+
+func (c *InvoiceController) RefundInvoice(ctx *gin.Context) {
+	c.createCreditNote(ctx, c.invoiceService.RefundInvoice)
+}
+
+func (c *InvoiceController) createCreditNote(ctx *gin.Context, create func(int, models.CreateCreditNoteInput, models.Actor) (*models.CreditNote, error)) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	var input models.CreateCreditNoteInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	input.ApprovedBy = middleware.CurrentStaff(ctx).Username
+	if till := middleware.CurrentTillSession(ctx); till != nil {
+		input.TillSessionID = &till.ID
+	}
+
+	note, err := create(id, input, middleware.CurrentActor(ctx))
+	if err != nil {
+		respondWithError(ctx, err, "Invoice not found")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, note)
+}
+
+func (c *InvoiceController) RecordPayment(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	var input models.CreatePaymentInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if till := middleware.CurrentTillSession(ctx); till != nil {
+		input.TillSessionID = &till.ID
+	}
+
+	invoice, err := c.invoiceService.RecordPayment(id, input, middleware.CurrentActor(ctx))
+	if err != nil {
+		respondWithError(ctx, err, "Invoice not found")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, invoice)
+}
+
+var invoiceExportHeader = []string{
+	"Invoice ID", "Order No", "Created At", "Status", "Invoice Total", "Invoice Tax",
+	"Line ID", "Item", "Size", "Quantity", "Unit Price", "Toppings Price", "Line Subtotal", "Toppings",
+}
+
+// GetReceiptPDF renders the invoice as a customer receipt. Pass
+// download=true to save it rather than open it in the browser.
+func (c *InvoiceController) GetReceiptPDF(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	invoice, err := c.invoiceService.GetInvoice(id)
+	if err != nil {
+		respondWithError(ctx, err, "Invoice not found")
+		return
+	}
+
+	var pdf bytes.Buffer
+	if err := receipt.WritePDF(&pdf, receipt.Receipt(invoice, receipt.PDFWidth)); err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	disposition := "inline"
+	if ctx.Query("download") == "true" {
+		disposition = "attachment"
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, "receipt-"+invoice.OrderNo+".pdf"))
+	ctx.Data(http.StatusOK, "application/pdf", pdf.Bytes())
+}
+
+// ExportInvoices streams invoice lines as CSV or XLSX. Query parameters:
+// format (csv or xlsx, default csv) and from/to as for GetAllInvoices.
+func (c *InvoiceController) ExportInvoices(ctx *gin.Context) {
+	formatName := ctx.DefaultQuery("format", "csv")
+	format, ok := export.Formats[formatName]
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or xlsx"})
+		return
+	}
+	from, err := parseDateParam(ctx, "from", false)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseDateParam(ctx, "to", true)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The response is only started once the first row arrives, so a failing
+	// query can still be reported as an error
+	var writer export.RowWriter
+	start := func() error {
+		filename := fmt.Sprintf("invoices-%s.%s", time.Now().Format("20060102-150405"), format.Extension)
+		ctx.Header("Content-Type", format.ContentType)
+		ctx.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		ctx.Status(http.StatusOK)
+
+		var err error
+		writer, err = format.New(ctx.Writer)
+		if err != nil {
+			return err
+		}
+		header := make([]export.Cell, len(invoiceExportHeader))
+		for i, title := range invoiceExportHeader {
+			header[i] = export.Text(title)
+		}
+		return writer.WriteRow(header)
+	}
+
+	count := 0
+	err = c.invoiceService.ExportInvoiceLines(from, to, func(row models.InvoiceExportRow) error {
+		if writer == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := writer.WriteRow(invoiceExportCells(row)); err != nil {
+			return err
+		}
+		count++
+		if count%500 == 0 {
+			if err := writer.Flush(); err != nil {
+				return err
+			}
+			ctx.Writer.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if writer == nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// Too late to change the status; the file is left unfinished so it
+		// can't be mistaken for a complete export
+		ctx.Error(err)
+		return
+	}
+
+	if writer == nil {
+		// No invoices in the range: still send a file with just the header
+		if err := start(); err != nil {
+			ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if err := writer.Close(); err != nil {
+		ctx.Error(err)
+	}
+}
+
+func invoiceExportCells(row models.InvoiceExportRow) []export.Cell {
+	cells := []export.Cell{
+		export.Text(strconv.Itoa(row.InvoiceID)),
+		export.Text(row.OrderNo),
+		export.Text(row.CreatedAt.Format("2006-01-02 15:04:05")),
+		export.Text(row.Status),
+		export.Number(row.TotalAmount),
+		export.Number(row.TaxAmount),
+	}
+	if row.LineID == nil {
+		// Pad so every row has the same columns
+		for len(cells) < len(invoiceExportHeader) {
+			cells = append(cells, export.Text(""))
+		}
+		return cells
+	}
+
+	itemName, size := "", ""
+	if row.ItemName != nil {
+		itemName = *row.ItemName
+	}
+	if row.Size != nil {
+		size = *row.Size
+	}
+	var toppingsPrice models.Money
+	if row.ToppingsPrice != nil {
+		toppingsPrice = *row.ToppingsPrice
+	}
+	return append(cells,
+		export.Text(strconv.Itoa(*row.LineID)),
+		export.Text(itemName),
+		export.Text(size),
+		export.Text(strconv.Itoa(*row.Quantity)),
+		export.Number(*row.UnitPrice),
+		export.Number(toppingsPrice),
+		export.Number(*row.Subtotal),
+		export.Text(row.Toppings),
+	)
+}
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"bytes"
+	"pizza-shop/export"
+	"pizza-shop/models"
+	"testing"
+	"time"
+)
+
+// TestInvoiceExportLayout pins the export columns, which spreadsheets and
+// imports downstream rely on, for an invoice with and without lines.
+func TestInvoiceExportLayout(t *testing.T) {
+	lineID, quantity := 7, 2
+	name, size := "=Margherita", "large"
+	unitPrice, toppingsPrice, subtotal := models.Money(1200), models.Money(150), models.Money(2700)
+	created := time.Date(2026, 10, 17, 18, 30, 5, 0, time.UTC)
+
+	rows := []models.InvoiceExportRow{
+		{
+			InvoiceID: 3, OrderNo: "20261017-0001", CreatedAt: created, Status: models.InvoiceStatusCompleted,
+			TotalAmount: 2700, TaxAmount: 270,
+			LineID: &lineID, ItemName: &name, Size: &size, Quantity: &quantity,
+			UnitPrice: &unitPrice, ToppingsPrice: &toppingsPrice, Subtotal: &subtotal,
+			Toppings: "Olives x1 @ 1.50",
+		},
+		{InvoiceID: 4, OrderNo: "20261017-0002", CreatedAt: created, Status: models.InvoiceStatusOpen},
+	}
+
+	var buf bytes.Buffer
+	w, err := export.NewCSVWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]export.Cell, len(invoiceExportHeader))
+	for i, title := range invoiceExportHeader {
+		header[i] = export.Text(title)
+	}
+	if err := w.WriteRow(header); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		cells := invoiceExportCells(row)
+		if len(cells) != len(invoiceExportHeader) {
+			t.Errorf("invoice %d has %d columns, want %d", row.InvoiceID, len(cells), len(invoiceExportHeader))
+		}
+		if err := w.WriteRow(cells); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Invoice ID,Order No,Created At,Status,Invoice Total,Invoice Tax," +
+		"Line ID,Item,Size,Quantity,Unit Price,Toppings Price,Line Subtotal,Toppings\n" +
+		"3,20261017-0001,2026-10-17 18:30:05,completed,27.00,2.70,7,'=Margherita,large,2,12.00,1.50,27.00,Olives x1 @ 1.50\n" +
+		"4,20261017-0002,2026-10-17 18:30:05,open,0.00,0.00,,,,,,,,\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"path/filepath"
+	"pizza-shop/middleware"
 	"pizza-shop/models"
 	"pizza-shop/services"
 	"strconv"
@@ -51,7 +52,7 @@ func (c *ItemController) CreateItem(ctx *gin.Context) {
 		return
 	}
 
-	item, err := c.itemService.CreateItem(input)
+	item, err := c.itemService.CreateItem(input, middleware.CurrentActor(ctx))
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -67,7 +68,7 @@ func (c *ItemController) CreatePizzaPrices(ctx *gin.Context) {
 		return
 	}
 
-	pizza_price, err := c.itemService.CreatePizzaPrices(input)
+	pizza_price, err := c.itemService.CreatePizzaPrices(input, middleware.CurrentActor(ctx))
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -89,7 +90,7 @@ func (c *ItemController) UpdateItem(ctx *gin.Context) {
 		return
 	}
 
-	item, err := c.itemService.UpdateItem(id, input)
+	item, err := c.itemService.UpdateItem(id, input, middleware.CurrentActor(ctx))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
@@ -115,7 +116,7 @@ func (c *ItemController) UpdatePizzaPrices(ctx *gin.Context) {
 		return
 	}
 
-	err = c.itemService.UpdatePizzaPrices(id, input)
+	err = c.itemService.UpdatePizzaPrices(id, input, middleware.CurrentActor(ctx))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "Pizza price not found"})
@@ -137,7 +138,7 @@ func (c *ItemController) DeleteItem(ctx *gin.Context) {
 	}
 
 	// Attempt to delete the item
-	err = c.itemService.DeleteItem(id)
+	err = c.itemService.DeleteItem(id, middleware.CurrentActor(ctx))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			ctx.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"io"
+	"net/http"
+	"pizza-shop/events"
+	"pizza-shop/middleware"
+	"pizza-shop/models"
+	"pizza-shop/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type KDSController struct {
+	kdsService services.KDSService
+}
+
+func NewKDSController() *KDSController {
+	return &KDSController{
+		kdsService: services.KDSService{},
+	}
+}
+
+// GetTickets lists tickets. Query parameters: station (default all) and
+// status (open or ready, default open).
+func (c *KDSController) GetTickets(ctx *gin.Context) {
+	tickets, err := c.kdsService.GetTickets(ctx.Query("station"), ctx.DefaultQuery("status", models.KDSTicketOpen))
+	if err != nil {
+		respondWithError(ctx, err, "Ticket not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, tickets)
+}
+
+func (c *KDSController) GetTicket(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	ticket, err := c.kdsService.GetTicket(id)
+	if err != nil {
+		respondWithError(ctx, err, "Ticket not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ticket)
+}
+
+func (c *KDSController) BumpTicket(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	ticket, err := c.kdsService.BumpTicket(id, middleware.CurrentActor(ctx))
+	if err != nil {
+		respondWithError(ctx, err, "Ticket not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ticket)
+}
+
+func (c *KDSController) BumpItem(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket item ID"})
+		return
+	}
+
+	ticket, err := c.kdsService.BumpItem(id, middleware.CurrentActor(ctx))
+	if err != nil {
+		respondWithError(ctx, err, "Ticket item not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ticket)
+}
+
+// StreamTickets is a Server-Sent Events stream for kitchen screens. It opens
+// with a "snapshot" event listing the open tickets, then sends a "ticket"
+// event whenever one changes and a "heartbeat" event with the server time
+// every 15 seconds, which screens use to keep elapsed times ticking.
+func (c *KDSController) StreamTickets(ctx *gin.Context) {
+	station := ctx.Query("station")
+
+	// Subscribe before taking the snapshot so no change falls in between
+	sub, _, _ := events.Subscribe([]string{events.KitchenTicketChanged}, 0)
+	defer sub.Close()
+
+	tickets, err := c.kdsService.GetTickets(station, models.KDSTicketOpen)
+	if err != nil {
+		respondWithError(ctx, err, "Ticket not found")
+		return
+	}
+
+	startEventStream(ctx)
+	ctx.SSEvent("snapshot", tickets)
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				return false
+			}
+			// Anything else published under the kitchen topic isn't a
+			// ticket the screen can show
+			ticket, isTicket := event.Data.(models.KDSTicket)
+			if isTicket && (station == "" || ticket.Station == station) {
+				ctx.SSEvent("ticket", ticket)
+			}
+		case now := <-heartbeat.C:
+			ctx.SSEvent("heartbeat", gin.H{"time": now})
+		case <-ctx.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"net/http"
+	"pizza-shop/models"
+	"pizza-shop/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PrintController struct {
+	printService services.PrintService
+}
+
+func NewPrintController() *PrintController {
+	return &PrintController{
+		printService: services.PrintService{},
+	}
+}
+
+// PrintInvoice queues a receipt or kitchen ticket. The response is sent as
+// soon as the job is queued; poll GetPrintJob to see whether it printed.
+func (c *PrintController) PrintInvoice(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invoice ID"})
+		return
+	}
+
+	var input models.PrintInvoiceInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := c.printService.PrintInvoice(id, input.Target)
+	if err != nil {
+		respondWithError(ctx, err, "Invoice not found")
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, job)
+}
+
+func (c *PrintController) GetPrintJobs(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, c.printService.GetPrintJobs())
+}
+
+func (c *PrintController) GetPrintJob(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid print job ID"})
+		return
+	}
+
+	job, err := c.printService.GetPrintJob(id)
+	if err != nil {
+		respondWithError(ctx, err, "Print job not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, job)
+}
+
+func (c *PrintController) RetryPrintJob(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid print job ID"})
+		return
+	}
+
+	job, err := c.printService.RetryPrintJob(id)
+	if err != nil {
+		respondWithError(ctx, err, "Print job not found")
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, job)
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"net/http"
+	"pizza-shop/middleware"
+	"pizza-shop/models"
+	"pizza-shop/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ReportController struct {
+	reportService services.ReportService
+}
+
+func NewReportController() *ReportController {
+	return &ReportController{
+		reportService: services.ReportService{},
+	}
+}
+
+func (c *ReportController) GetXReport(ctx *gin.Context) {
+	report, err := c.reportService.GetXReport()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+func (c *ReportController) CloseZReport(ctx *gin.Context) {
+	input := models.CloseZReportInput{ClosedBy: middleware.CurrentStaff(ctx).Username}
+
+	report, err := c.reportService.CloseZReport(input)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, report)
+}
+
+func (c *ReportController) GetZReports(ctx *gin.Context) {
+	reports, err := c.reportService.GetZReports()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, reports)
+}
+
+func (c *ReportController) GetZReport(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report ID"})
+		return
+	}
+
+	report, err := c.reportService.GetZReport(id)
+	if err != nil {
+		respondWithError(ctx, err, "Z report not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
+
+// GetSalesAnalytics aggregates sales over from/to (YYYY-MM-DD, inclusive),
+// defaulting to the last 30 days.
+func (c *ReportController) GetSalesAnalytics(ctx *gin.Context) {
+	from, err := parseDateParam(ctx, "from", false)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	to, err := parseDateParam(ctx, "to", true)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if to == nil {
+		now := time.Now()
+		tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.Local)
+		to = &tomorrow
+	}
+	if from == nil {
+		monthAgo := to.AddDate(0, 0, -30)
+		from = &monthAgo
+	}
+
+	analytics, err := c.reportService.GetSalesAnalytics(*from, *to)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, analytics)
+}
@@ -0,0 +1,70 @@
+package controllers
+
+import (
+	"net/http"
+	"pizza-shop/models"
+	"pizza-shop/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StaffController struct {
+	staffService services.StaffService
+}
+
+func NewStaffController() *StaffController {
+	return &StaffController{
+		staffService: services.StaffService{},
+	}
+}
+
+func (c *StaffController) GetAllStaff(ctx *gin.Context) {
+	staff, err := c.staffService.GetAllStaff()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, staff)
+}
+
+func (c *StaffController) CreateStaff(ctx *gin.Context) {
+	var input models.CreateStaffInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	staff, err := c.staffService.CreateStaff(input)
+	if err != nil {
+		respondWithError(ctx, err, "Staff member not found")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, staff)
+}
+
+// UpdateStaff changes a staff member's details. Staff are deactivated rather
+// than deleted so their name stays on the records they made.
+func (c *StaffController) UpdateStaff(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid staff ID"})
+		return
+	}
+
+	var input models.UpdateStaffInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	staff, err := c.staffService.UpdateStaff(id, input)
+	if err != nil {
+		respondWithError(ctx, err, "Staff member not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, staff)
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"net/http"
+	"pizza-shop/models"
+	"pizza-shop/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TaxController struct {
+	taxService services.TaxService
+}
+
+func NewTaxController() *TaxController {
+	return &TaxController{
+		taxService: services.TaxService{},
+	}
+}
+
+func (c *TaxController) GetTaxRules(ctx *gin.Context) {
+	rules, err := c.taxService.GetTaxRules()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, rules)
+}
+
+func (c *TaxController) CreateTaxRule(ctx *gin.Context) {
+	var input models.CreateTaxRuleInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := c.taxService.CreateTaxRule(input)
+	if err != nil {
+		respondWithError(ctx, err, "Tax rule not found")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, rule)
+}
+
+func (c *TaxController) UpdateTaxRule(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tax rule ID"})
+		return
+	}
+
+	var input models.UpdateTaxRuleInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := c.taxService.UpdateTaxRule(id, input)
+	if err != nil {
+		respondWithError(ctx, err, "Tax rule not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, rule)
+}
+
+func (c *TaxController) DeleteTaxRule(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tax rule ID"})
+		return
+	}
+
+	err = c.taxService.DeleteTaxRule(id)
+	if err != nil {
+		respondWithError(ctx, err, "Tax rule not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Tax rule deleted successfully"})
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"net/http"
+	"pizza-shop/middleware"
+	"pizza-shop/models"
+	"pizza-shop/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TillController struct {
+	tillService services.TillService
+}
+
+func NewTillController() *TillController {
+	return &TillController{
+		tillService: services.TillService{},
+	}
+}
+
+func (c *TillController) GetTerminals(ctx *gin.Context) {
+	terminals, err := c.tillService.GetTerminals()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, terminals)
+}
+
+func (c *TillController) CreateTerminal(ctx *gin.Context) {
+	var input models.CreateTerminalInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	terminal, err := c.tillService.CreateTerminal(input)
+	if err != nil {
+		respondWithError(ctx, err, "Terminal not found")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, terminal)
+}
+
+// PINLogin clocks a cashier onto a terminal. It returns a token like
+// /auth/login, which stops working while the till session is locked.
+func (c *TillController) PINLogin(ctx *gin.Context) {
+	terminalID, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid terminal ID"})
+		return
+	}
+
+	var input models.PINLoginInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := c.tillService.PINLogin(terminalID, input)
+	if err != nil {
+		respondWithError(ctx, err, "Terminal not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, session)
+}
+
+// GetTillSessions lists till sessions. Query parameters: terminal_id and
+// status (active, locked or closed).
+func (c *TillController) GetTillSessions(ctx *gin.Context) {
+	terminalID := 0
+	if value := ctx.Query("terminal_id"); value != "" {
+		var err error
+		if terminalID, err = strconv.Atoi(value); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid terminal ID"})
+			return
+		}
+	}
+
+	sessions, err := c.tillService.GetTillSessions(terminalID, ctx.Query("status"))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, sessions)
+}
+
+// GetCurrentTillSession returns the caller's till session.
+func (c *TillController) GetCurrentTillSession(ctx *gin.Context) {
+	till := middleware.CurrentTillSession(ctx)
+	if till == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Not logged in on a till"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, till)
+}
+
+// LockCurrentTillSession locks the caller's till session when they step
+// away; their PIN unlocks it again.
+func (c *TillController) LockCurrentTillSession(ctx *gin.Context) {
+	c.updateCurrent(ctx, c.tillService.LockTillSession)
+}
+
+// CloseCurrentTillSession clocks the caller off their till.
+func (c *TillController) CloseCurrentTillSession(ctx *gin.Context) {
+	c.updateCurrent(ctx, c.tillService.CloseTillSession)
+}
+
+func (c *TillController) updateCurrent(ctx *gin.Context, update func(int) (*models.TillSession, error)) {
+	till := middleware.CurrentTillSession(ctx)
+	if till == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "Not logged in on a till"})
+		return
+	}
+
+	session, err := update(till.ID)
+	if err != nil {
+		respondWithError(ctx, err, "Till session not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, session)
+}
+
+// CloseTillSession lets a manager clock off a cashier who left without
+// doing so.
+func (c *TillController) CloseTillSession(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid till session ID"})
+		return
+	}
+
+	session, err := c.tillService.CloseTillSession(id)
+	if err != nil {
+		respondWithError(ctx, err, "Till session not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, session)
+}
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"net/http"
+	"pizza-shop/models"
+	"pizza-shop/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookController struct {
+	webhookService services.WebhookService
+}
+
+func NewWebhookController() *WebhookController {
+	return &WebhookController{
+		webhookService: services.WebhookService{},
+	}
+}
+
+func (c *WebhookController) GetWebhooks(ctx *gin.Context) {
+	endpoints, err := c.webhookService.GetWebhooks()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, endpoints)
+}
+
+func (c *WebhookController) CreateWebhook(ctx *gin.Context) {
+	var input models.CreateWebhookInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	endpoint, err := c.webhookService.CreateWebhook(input)
+	if err != nil {
+		respondWithError(ctx, err, "Webhook not found")
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, endpoint)
+}
+
+func (c *WebhookController) UpdateWebhook(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	var input models.UpdateWebhookInput
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	endpoint, err := c.webhookService.UpdateWebhook(id, input)
+	if err != nil {
+		respondWithError(ctx, err, "Webhook not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, endpoint)
+}
+
+func (c *WebhookController) DeleteWebhook(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	err = c.webhookService.DeleteWebhook(id)
+	if err != nil {
+		respondWithError(ctx, err, "Webhook not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// GetDeliveries lists a webhook's deliveries. Query parameters: status
+// (pending, delivered or failed) and limit (default 50, at most 500).
+func (c *WebhookController) GetDeliveries(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook ID"})
+		return
+	}
+
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 500 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+		return
+	}
+
+	deliveries, err := c.webhookService.GetDeliveries(id, ctx.Query("status"), limit)
+	if err != nil {
+		respondWithError(ctx, err, "Webhook not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, deliveries)
+}
+
+func (c *WebhookController) Redeliver(ctx *gin.Context) {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery ID"})
+		return
+	}
+
+	delivery, err := c.webhookService.Redeliver(id)
+	if err != nil {
+		respondWithError(ctx, err, "Delivery not found")
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, delivery)
+}
@@ -0,0 +1,206 @@
+// Package events is an in-process publish/subscribe bus that tells
+// connected screens about changes to the menu, orders and kitchen tickets.
+package events
+
+import (
+	"pizza-shop/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event types. The part before the dot is the topic subscribers filter on.
+const (
+	ItemCreated          = "item.created"         // Data is models.Item
+	ItemUpdated          = "item.updated"         // Data is models.Item
+	ItemDeleted          = "item.deleted"         // Data is ItemRef
+	PriceChanged         = "item.price_changed"   // Data is PriceChange
+	ItemOutOfStock       = "item.out_of_stock"    // Data is ItemStock
+	ItemRestocked        = "item.restocked"       // Data is ItemStock
+	ToppingOutOfStock    = "topping.out_of_stock" // Data is ToppingStock
+	ToppingRestocked     = "topping.restocked"    // Data is ToppingStock
+	InvoiceCreated       = "invoice.created"      // Data is models.Invoice
+	InvoiceStatusChanged = "invoice.status_changed"
+	KitchenTicketChanged = "kds.ticket_changed" // Data is models.KDSTicket
+)
+
+// Types lists every event type.
+var Types = []string{
+	ItemCreated,
+	ItemUpdated,
+	ItemDeleted,
+	PriceChanged,
+	ItemOutOfStock,
+	ItemRestocked,
+	ToppingOutOfStock,
+	ToppingRestocked,
+	InvoiceCreated,
+	InvoiceStatusChanged,
+	KitchenTicketChanged,
+}
+
+type ItemRef struct {
+	ItemID int `json:"item_id"`
+}
+
+// PriceChange is the new price of an item. Size is set for pizza base
+// prices.
+type PriceChange struct {
+	ItemID int          `json:"item_id"`
+	Size   *string      `json:"size,omitempty"`
+	Price  models.Money `json:"price"`
+}
+
+// ItemStock is an item that has sold out or can be made again.
+type ItemStock struct {
+	ItemID int    `json:"item_id"`
+	Name   string `json:"name"`
+}
+
+// ToppingStock is a topping that has sold out or can be made again.
+type ToppingStock struct {
+	ToppingID int    `json:"topping_id"`
+	Name      string `json:"name"`
+}
+
+// StatusChange is the data for InvoiceStatusChanged.
+type StatusChange struct {
+	InvoiceID int    `json:"invoice_id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+}
+
+type Event struct {
+	ID   uint64      `json:"id"`
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+func (e Event) Topic() string {
+	topic, _, _ := strings.Cut(e.Type, ".")
+	return topic
+}
+
+// subscriberBuffer is how many events a subscriber may fall behind by
+// before it is dropped.
+const subscriberBuffer = 64
+
+// Subscription receives events on C until it is closed. C is also closed if
+// the subscriber falls too far behind; it can then subscribe again from the
+// last event it saw.
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	topics map[string]bool
+	bus    *Bus
+}
+
+func (s *Subscription) wants(e Event) bool {
+	return len(s.topics) == 0 || s.topics[e.Topic()] || s.topics[e.Type]
+}
+
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.drop(s)
+}
+
+// Bus delivers events to subscribers and keeps the most recent ones so that
+// subscribers can catch up after reconnecting.
+type Bus struct {
+	mu          sync.Mutex
+	lastID      uint64
+	history     []Event
+	historySize int
+	subscribers map[*Subscription]bool
+}
+
+func NewBus(historySize int) *Bus {
+	return &Bus{
+		// IDs start from the clock so those issued after a restart are
+		// higher than any a client remembers from before it
+		lastID:      uint64(time.Now().UnixMicro()),
+		historySize: historySize,
+		subscribers: make(map[*Subscription]bool),
+	}
+}
+
+func (b *Bus) Publish(eventType string, data interface{}) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	event := Event{ID: b.lastID, Type: eventType, Time: time.Now(), Data: data}
+
+	b.history = append(b.history, event)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	for sub := range b.subscribers {
+		if !sub.wants(event) {
+			continue
+		}
+		select {
+		case sub.c <- event:
+		default:
+			b.drop(sub)
+		}
+	}
+
+	return event
+}
+
+// Subscribe delivers events on the given topics or event types, or all
+// events if none are given. If after is non-zero, the matching events
+// published since that ID are returned to be sent first; complete is false
+// when some of them are no longer kept and the subscriber should reload
+// its state instead.
+func (b *Bus) Subscribe(topics []string, after uint64) (sub *Subscription, missed []Event, complete bool) {
+	c := make(chan Event, subscriberBuffer)
+	sub = &Subscription{C: c, c: c, topics: make(map[string]bool), bus: b}
+	for _, topic := range topics {
+		sub.topics[topic] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers[sub] = true
+
+	if after == 0 {
+		return sub, nil, true
+	}
+
+	oldest := b.lastID + 1
+	if len(b.history) > 0 {
+		oldest = b.history[0].ID
+	}
+	complete = after >= oldest-1 && after <= b.lastID
+	for _, event := range b.history {
+		if event.ID > after && sub.wants(event) {
+			missed = append(missed, event)
+		}
+	}
+	return sub, missed, complete
+}
+
+// drop removes a subscriber. The caller must hold b.mu.
+func (b *Bus) drop(sub *Subscription) {
+	if b.subscribers[sub] {
+		delete(b.subscribers, sub)
+		close(sub.c)
+	}
+}
+
+var bus = NewBus(1000)
+
+// Publish sends an event on the application's bus.
+func Publish(eventType string, data interface{}) Event {
+	return bus.Publish(eventType, data)
+}
+
+// Subscribe listens on the application's bus. See Bus.Subscribe.
+func Subscribe(topics []string, after uint64) (*Subscription, []Event, bool) {
+	return bus.Subscribe(topics, after)
+}
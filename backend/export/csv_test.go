@@ -0,0 +1,42 @@
+package export
+
+import (
+	"bytes"
+	"testing"
+)
+
+type decimal string
+
+func (d decimal) String() string { return string(d) }
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewCSVWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]Cell{
+		{Text("Item"), Text("Toppings"), Text("Total")},
+		{Text("Margherita"), Text(""), Number(decimal("12.50"))},
+		{Text(`Chef's "special", large`), Text("Olives x2 @ 0.75; Onions x1 @ 0.50"), Number(decimal("-3.00"))},
+		{Text("=HYPERLINK(\"http://example.com\")"), Text("+1"), Number(decimal("0.00"))},
+		{Text("-2 discount"), Text("@SUM(A1)"), Text("\tTab")},
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Item,Toppings,Total\n" +
+		"Margherita,,12.50\n" +
+		"\"Chef's \"\"special\"\", large\",Olives x2 @ 0.75; Onions x1 @ 0.50,-3.00\n" +
+		"\"'=HYPERLINK(\"\"http://example.com\"\")\",'+1,0.00\n" +
+		"'-2 discount,'@SUM(A1),'\tTab\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,51 @@
+// Package export writes tabular data as CSV or XLSX, one row at a time, so
+// large exports can be streamed straight to the client.
+package export
+
+import (
+	"fmt"
+	"io"
+)
+
+// Cell is one value in a row. Numeric cells hold a decimal string such as
+// "12.50" and are written as numbers with two decimal places.
+type Cell struct {
+	Value   string
+	Numeric bool
+}
+
+func Text(value string) Cell {
+	return Cell{Value: value}
+}
+
+func Number(value fmt.Stringer) Cell {
+	return Cell{Value: value.String(), Numeric: true}
+}
+
+// RowWriter writes rows in some file format. Close must be called to finish
+// the file; it does not close the underlying writer.
+type RowWriter interface {
+	WriteRow(cells []Cell) error
+	Flush() error
+	Close() error
+}
+
+// Format describes a supported export format.
+type Format struct {
+	ContentType string
+	Extension   string
+	New         func(w io.Writer) (RowWriter, error)
+}
+
+var Formats = map[string]Format{
+	"csv": {
+		ContentType: "text/csv; charset=utf-8",
+		Extension:   "csv",
+		New:         NewCSVWriter,
+	},
+	"xlsx": {
+		ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		Extension:   "xlsx",
+		New:         NewXLSXWriter,
+	},
+}
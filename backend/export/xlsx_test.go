@@ -0,0 +1,103 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+)
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewXLSXWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]Cell{
+		{Text("Item"), Text("Total")},
+		{Text(`Fish & Chips <"large">`), Number(decimal("12.50"))},
+		{Text("=1+1"), Number(decimal("-3.00"))},
+		{Text("Crème brûlée"), Number(decimal(""))},
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string]string)
+	var names []string
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name] = string(content)
+		names = append(names, f.Name)
+	}
+
+	wantNames := []string{
+		"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels",
+		"xl/styles.xml", "xl/worksheets/sheet1.xml",
+	}
+	if len(names) != len(wantNames) {
+		t.Fatalf("parts = %q, want %q", names, wantNames)
+	}
+	for i, name := range wantNames {
+		if names[i] != name {
+			t.Errorf("part %d = %q, want %q", i, names[i], name)
+		}
+	}
+	for name, content := range parts {
+		if err := xml.Unmarshal([]byte(content), new(struct{})); err != nil {
+			t.Errorf("%s is not well-formed XML: %v", name, err)
+		}
+	}
+
+	// Text is escaped and never a formula; numbers use the two decimal
+	// places style; the header is bold
+	want := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+		`<row r="1">` +
+		`<c r="A1" s="2" t="inlineStr"><is><t xml:space="preserve">Item</t></is></c>` +
+		`<c r="B1" s="2" t="inlineStr"><is><t xml:space="preserve">Total</t></is></c>` +
+		`</row>` +
+		`<row r="2">` +
+		`<c r="A2" t="inlineStr"><is><t xml:space="preserve">Fish &amp; Chips &lt;&#34;large&#34;&gt;</t></is></c>` +
+		`<c r="B2" s="1"><v>12.50</v></c>` +
+		`</row>` +
+		`<row r="3">` +
+		`<c r="A3" t="inlineStr"><is><t xml:space="preserve">=1+1</t></is></c>` +
+		`<c r="B3" s="1"><v>-3.00</v></c>` +
+		`</row>` +
+		`<row r="4">` +
+		`<c r="A4" t="inlineStr"><is><t xml:space="preserve">Crème brûlée</t></is></c>` +
+		`<c r="B4" t="inlineStr"><is><t xml:space="preserve"></t></is></c>` +
+		`</row>` +
+		`</sheetData></worksheet>`
+	if got := parts["xl/worksheets/sheet1.xml"]; got != want {
+		t.Errorf("sheet =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestColumnName(t *testing.T) {
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"}
+	for index, want := range tests {
+		if got := columnName(index); got != want {
+			t.Errorf("columnName(%d) = %q, want %q", index, got, want)
+		}
+	}
+}
@@ -5,20 +5,29 @@ import (
 	"os"
 	"pizza-shop/config"
 	"pizza-shop/controllers"
+	"pizza-shop/middleware"
+	"pizza-shop/models"
+	"pizza-shop/services"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
 	config.InitDB()
+	config.InitSettings()
+	if err := services.EnsureAdmin(); err != nil {
+		log.Fatal(err)
+	}
+	services.StartWebhooks()
 
-	r := gin.Default()
+	r := gin.New()
+	r.Use(middleware.Logger(), gin.Recovery())
 
 	// Enable CORS
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -39,30 +48,144 @@ func main() {
 	// Create controllers
 	itemController := controllers.NewItemController()
 	invoiceController := controllers.NewInvoiceController()
+	taxController := controllers.NewTaxController()
+	reportController := controllers.NewReportController()
+	printController := controllers.NewPrintController()
+	kdsController := controllers.NewKDSController()
+	eventController := controllers.NewEventController()
+	webhookController := controllers.NewWebhookController()
+	authController := controllers.NewAuthController()
+	staffController := controllers.NewStaffController()
+	tillController := controllers.NewTillController()
+	auditController := controllers.NewAuditController()
+	cashDrawerController := controllers.NewCashDrawerController()
+	inventoryController := controllers.NewInventoryController()
+
+	// Routes are grouped by who may use them. Admins can use every route.
+	api := r.Group("/api")
+	staff := api.Group("", middleware.Authenticate())
+	cashiers := staff.Group("", middleware.RequireRole(models.RoleCashier, models.RoleManager))
+	kitchen := staff.Group("", middleware.RequireRole(models.RoleKitchen, models.RoleManager))
+	floor := staff.Group("", middleware.RequireRole(models.RoleCashier, models.RoleKitchen, models.RoleManager))
+	managers := staff.Group("", middleware.RequireRole(models.RoleManager))
+	admins := staff.Group("", middleware.RequireRole(models.RoleAdmin))
+
+	// Server-Sent Events, which may also pass the token in the query string
+	streams := api.Group("", middleware.AuthenticateStream())
+	floorStreams := streams.Group("", middleware.RequireRole(models.RoleCashier, models.RoleKitchen, models.RoleManager))
+
+	// Cashiers sell from a till, so their sales record the terminal
+	tillOnly := middleware.RequireTillSession(models.RoleCashier)
+
+	// Login
+	api.POST("/auth/login", authController.Login)
+	staff.GET("/auth/me", authController.Me)
+
+	// Tills
+	staff.GET("/terminals", tillController.GetTerminals)
+	managers.POST("/terminals", tillController.CreateTerminal)
+	api.POST("/terminals/:id/pin-login", tillController.PINLogin)
+	staff.GET("/till-sessions/current", tillController.GetCurrentTillSession)
+	staff.POST("/till-sessions/current/lock", tillController.LockCurrentTillSession)
+	staff.POST("/till-sessions/current/close", tillController.CloseCurrentTillSession)
+	managers.GET("/till-sessions", tillController.GetTillSessions)
+	managers.POST("/till-sessions/:id/close", tillController.CloseTillSession)
+
+	// Cash drawers
+	cashiers.GET("/cash-drawers/current", cashDrawerController.GetCurrentCashDrawer)
+	cashiers.POST("/cash-drawers/current/open", cashDrawerController.OpenCashDrawer)
+	cashiers.POST("/cash-drawers/current/movements", cashDrawerController.AddCurrentCashMovement)
+	cashiers.POST("/cash-drawers/current/close", cashDrawerController.CloseCurrentCashDrawer)
+	managers.GET("/cash-drawers", cashDrawerController.GetCashDrawers)
+	managers.GET("/cash-drawers/:id", cashDrawerController.GetCashDrawer)
+	managers.POST("/cash-drawers/:id/movements", cashDrawerController.AddCashMovement)
+	managers.POST("/cash-drawers/:id/close", cashDrawerController.CloseCashDrawer)
 
 	// Item routes
-	r.GET("/api/items", itemController.GetAllItems)
-	r.GET("/api/items/:category", itemController.GetItemsByCategory)
-	r.POST("/api/items", itemController.CreateItem)
-	r.PUT("/api/items/:id", itemController.UpdateItem)
-	r.DELETE("/api/items/:id", itemController.DeleteItem)
-	r.POST("/api/upload", itemController.UploadImage)
+	api.GET("/items", itemController.GetAllItems)
+	api.GET("/items/:category", itemController.GetItemsByCategory)
+	managers.POST("/items", itemController.CreateItem)
+	managers.PUT("/items/:id", itemController.UpdateItem)
+	managers.DELETE("/items/:id", itemController.DeleteItem)
+	managers.POST("/upload", itemController.UploadImage)
 
 	// Pizza prices
-	r.GET("/api/pizzas-with-prices", itemController.GetPizzasWithPrices)
-	r.GET("/api/pizzas/:id/prices", itemController.GetPizzaPricesById)
-	r.POST("/api/pizzaprice", itemController.CreatePizzaPrices)
-	r.PUT("/api/pizzaprice/:id", itemController.UpdatePizzaPrices)
+	api.GET("/pizzas-with-prices", itemController.GetPizzasWithPrices)
+	api.GET("/pizzas/:id/prices", itemController.GetPizzaPricesById)
+	managers.POST("/pizzaprice", itemController.CreatePizzaPrices)
+	managers.PUT("/pizzaprice/:id", itemController.UpdatePizzaPrices)
 
 	// Toppings
-	r.GET("/api/toppings", itemController.GetToppings)
+	api.GET("/toppings", itemController.GetToppings)
+
+	// Stock
+	floor.GET("/ingredients", inventoryController.GetIngredients)
+	managers.POST("/ingredients", inventoryController.CreateIngredient)
+	managers.PUT("/ingredients/:id", inventoryController.UpdateIngredient)
+	managers.POST("/ingredients/:id/adjust", inventoryController.AdjustStock)
+	managers.GET("/recipes/items/:id", inventoryController.GetItemRecipe)
+	managers.PUT("/recipes/items/:id", inventoryController.SetItemRecipe)
+	managers.GET("/recipes/toppings/:id", inventoryController.GetToppingRecipe)
+	managers.PUT("/recipes/toppings/:id", inventoryController.SetToppingRecipe)
+	floor.GET("/stock/shortages", inventoryController.GetStockShortages)
 
 	// Invoice routes
-	r.POST("/api/invoices", invoiceController.CreateInvoice)
-	r.GET("/api/invoices", invoiceController.GetAllInvoices)
-	r.GET("/api/invoices/:id", invoiceController.GetInvoice)
-	r.GET("/api/invoices/:id/items", invoiceController.GetInvoiceItems)
-	r.GET("/api/invoices/latest-order-no", invoiceController.GetLatestOrderNo)
+	cashiers.POST("/invoices", tillOnly, invoiceController.CreateInvoice)
+	cashiers.GET("/invoices", invoiceController.GetAllInvoices)
+	managers.GET("/invoices/export", invoiceController.ExportInvoices)
+	cashiers.GET("/invoices/:id", invoiceController.GetInvoice)
+	cashiers.GET("/invoices/:id/items", invoiceController.GetInvoiceItems)
+	cashiers.GET("/invoices/:id/receipt.pdf", invoiceController.GetReceiptPDF)
+	floor.PATCH("/invoices/:id/status", invoiceController.UpdateStatus)
+	managers.POST("/invoices/:id/void", invoiceController.VoidInvoice)
+	managers.POST("/invoices/:id/refund", invoiceController.RefundInvoice)
+	cashiers.POST("/invoices/:id/payments", tillOnly, invoiceController.RecordPayment)
+	cashiers.GET("/invoices/latest-order-no", invoiceController.GetLatestOrderNo)
+
+	// Printing
+	floor.POST("/invoices/:id/print", printController.PrintInvoice)
+	floor.GET("/print-jobs", printController.GetPrintJobs)
+	floor.GET("/print-jobs/:id", printController.GetPrintJob)
+	floor.POST("/print-jobs/:id/retry", printController.RetryPrintJob)
+
+	// Kitchen display
+	floor.GET("/kds/tickets", kdsController.GetTickets)
+	floor.GET("/kds/tickets/:id", kdsController.GetTicket)
+	kitchen.POST("/kds/tickets/:id/bump", kdsController.BumpTicket)
+	kitchen.POST("/kds/items/:id/bump", kdsController.BumpItem)
+	floorStreams.GET("/kds/stream", kdsController.StreamTickets)
+
+	// Live updates
+	streams.GET("/events", eventController.StreamEvents)
+
+	// Webhooks
+	admins.GET("/webhooks", webhookController.GetWebhooks)
+	admins.POST("/webhooks", webhookController.CreateWebhook)
+	admins.PUT("/webhooks/:id", webhookController.UpdateWebhook)
+	admins.DELETE("/webhooks/:id", webhookController.DeleteWebhook)
+	admins.GET("/webhooks/:id/deliveries", webhookController.GetDeliveries)
+	admins.POST("/webhook-deliveries/:id/redeliver", webhookController.Redeliver)
+
+	// Staff accounts
+	admins.GET("/staff", staffController.GetAllStaff)
+	admins.POST("/staff", staffController.CreateStaff)
+	admins.PUT("/staff/:id", staffController.UpdateStaff)
+
+	// Tax rules
+	managers.GET("/tax-rules", taxController.GetTaxRules)
+	managers.POST("/tax-rules", taxController.CreateTaxRule)
+	managers.PUT("/tax-rules/:id", taxController.UpdateTaxRule)
+	managers.DELETE("/tax-rules/:id", taxController.DeleteTaxRule)
+
+	// Shift reports
+	managers.GET("/reports/x", reportController.GetXReport)
+	managers.GET("/reports/z", reportController.GetZReports)
+	managers.GET("/reports/z/:id", reportController.GetZReport)
+	managers.POST("/reports/z", reportController.CloseZReport)
+	managers.GET("/reports/analytics", reportController.GetSalesAnalytics)
+
+	// Audit log
+	managers.GET("/audit", auditController.GetAuditLog)
 
 	r.Run(":8080")
 }
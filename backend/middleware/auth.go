@@ -0,0 +1,135 @@
+// Package middleware holds gin middleware shared by the API routes.
+package middleware
+
+import (
+	"net/http"
+	"pizza-shop/auth"
+	"pizza-shop/models"
+	"pizza-shop/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	staffKey       = "staff"
+	tillSessionKey = "till_session"
+)
+
+// Authenticate rejects requests without a valid token in the Authorization
+// header ("Bearer <token>").
+func Authenticate() gin.HandlerFunc {
+	return authenticate(false)
+}
+
+// AuthenticateStream is Authenticate for Server-Sent Events routes. It also
+// takes the token from the access_token query parameter, since EventSource
+// can't set headers; Logger keeps it out of the access log.
+func AuthenticateStream() gin.HandlerFunc {
+	return authenticate(true)
+}
+
+func authenticate(allowQuery bool) gin.HandlerFunc {
+	staffService := services.StaffService{}
+
+	return func(ctx *gin.Context) {
+		token := strings.TrimPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if token == "" && allowQuery {
+			token = ctx.Query("access_token")
+		}
+		if token == "" {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Login required"})
+			return
+		}
+
+		staff, till, err := staffService.Authenticate(token)
+		if err == auth.ErrInvalidToken || err == services.ErrTillSessionLocked {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.Set(staffKey, staff)
+		if till != nil {
+			ctx.Set(tillSessionKey, till)
+		}
+		ctx.Next()
+	}
+}
+
+// RequireRole only lets through staff with one of the given roles. Admins
+// are always let through. It must run after Authenticate.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		staff := CurrentStaff(ctx)
+		if staff == nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Login required"})
+			return
+		}
+
+		if staff.Role == models.RoleAdmin {
+			ctx.Next()
+			return
+		}
+		for _, role := range roles {
+			if staff.Role == role {
+				ctx.Next()
+				return
+			}
+		}
+
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Your role can't do this"})
+	}
+}
+
+// RequireTillSession makes staff with one of the given roles log in on a
+// till with their PIN, so what they do is recorded against a terminal and
+// the till's idle lock and PIN lockout apply to them. Other roles are let
+// through. It must run after Authenticate.
+func RequireTillSession(roles ...string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		staff := CurrentStaff(ctx)
+		if staff == nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Login required"})
+			return
+		}
+
+		for _, role := range roles {
+			if staff.Role == role && CurrentTillSession(ctx) == nil {
+				ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Log in on a till with your PIN to do this"})
+				return
+			}
+		}
+		ctx.Next()
+	}
+}
+
+// CurrentStaff returns the authenticated staff member, or nil if the route
+// isn't authenticated.
+func CurrentStaff(ctx *gin.Context) *models.Staff {
+	if staff, ok := ctx.Get(staffKey); ok {
+		return staff.(*models.Staff)
+	}
+	return nil
+}
+
+// CurrentActor describes the authenticated staff member for the audit log.
+func CurrentActor(ctx *gin.Context) models.Actor {
+	staff := CurrentStaff(ctx)
+	if staff == nil {
+		return models.SystemActor
+	}
+	return models.Actor{StaffID: &staff.ID, Name: staff.Name}
+}
+
+// CurrentTillSession returns the till session of a staff member logged in
+// with their PIN, or nil for password logins.
+func CurrentTillSession(ctx *gin.Context) *models.TillSession {
+	if till, ok := ctx.Get(tillSessionKey); ok {
+		return till.(*models.TillSession)
+	}
+	return nil
+}
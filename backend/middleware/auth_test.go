@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TestQueryToken checks only stream routes look at access_token: elsewhere
+// a token in the query string is as good as none.
+func TestQueryToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/items", Authenticate(), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+	r.GET("/api/events", AuthenticateStream(), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	tests := []struct {
+		path, wantError string
+	}{
+		{"/api/items?access_token=not.a.token", "Login required"},
+		{"/api/events?access_token=not.a.token", "invalid or expired token"},
+		{"/api/events", "Login required"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), tt.wantError) {
+			t.Errorf("GET %s: %d %s, want 401 %q", tt.path, w.Code, w.Body.String(), tt.wantError)
+		}
+	}
+}
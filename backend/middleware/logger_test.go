@@ -0,0 +1,20 @@
+package middleware
+
+import "testing"
+
+func TestRedactToken(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"/api/items", "/api/items"},
+		{"/api/kds/stream?station=pizza", "/api/kds/stream?station=pizza"},
+		{"/api/events?access_token=abc.def.ghi", "/api/events?access_token=REDACTED"},
+		{"/api/kds/stream?station=pizza&access_token=abc", "/api/kds/stream?access_token=REDACTED&station=pizza"},
+		{"/api/events?access_token=abc;topics=item", "/api/events?[unparsed]"},
+	}
+	for _, tt := range tests {
+		if got := redactToken(tt.path); got != tt.want {
+			t.Errorf("redactToken(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
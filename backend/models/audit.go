@@ -0,0 +1,75 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit log actions
+const (
+	AuditItemCreated          = "item.created"
+	AuditItemUpdated          = "item.updated"
+	AuditItemDeleted          = "item.deleted"
+	AuditPizzaPriceCreated    = "item.pizza_price_created"
+	AuditPizzaPriceUpdated    = "item.pizza_price_updated"
+	AuditInvoiceCreated       = "invoice.created"
+	AuditInvoiceStatusChanged = "invoice.status_changed"
+	AuditInvoiceVoided        = "invoice.voided"
+	AuditInvoiceRefunded      = "invoice.refunded"
+	AuditPaymentRecorded      = "invoice.payment_recorded"
+	AuditIngredientCreated    = "ingredient.created"
+	AuditIngredientUpdated    = "ingredient.updated"
+	AuditStockAdjusted        = "ingredient.stock_adjusted"
+	AuditItemRecipeUpdated    = "item.recipe_updated"
+	AuditToppingRecipeUpdated = "topping.recipe_updated"
+)
+
+// Audited entity types
+const (
+	AuditEntityItem       = "item"
+	AuditEntityInvoice    = "invoice"
+	AuditEntityIngredient = "ingredient"
+	AuditEntityTopping    = "topping"
+)
+
+// Actor is who made a change. StaffID is nil for changes the system makes
+// on its own.
+type Actor struct {
+	StaffID *int
+	Name    string
+}
+
+var SystemActor = Actor{Name: "system"}
+
+// AuditEntry records one change. Before is null for creations and After is
+// null for deletions.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	ActorID    *int            `json:"actor_id"`
+	ActorName  string          `json:"actor_name"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entity_type"`
+	EntityID   int             `json:"entity_id"`
+	Before     json.RawMessage `json:"before"`
+	After      json.RawMessage `json:"after"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// AuditFilter narrows the audit log. Cursor is the next_cursor of the
+// previous page.
+type AuditFilter struct {
+	ActorID    *int
+	Action     string
+	EntityType string
+	EntityID   *int
+	From       *time.Time
+	To         *time.Time // Exclusive
+	Limit      int
+	Cursor     string
+}
+
+type AuditPage struct {
+	Data       []AuditEntry `json:"data"`
+	Limit      int          `json:"limit"`
+	NextCursor *string      `json:"next_cursor"`
+}
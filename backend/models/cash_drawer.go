@@ -0,0 +1,70 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	CashDrawerOpen   = "open"
+	CashDrawerClosed = "closed"
+)
+
+const (
+	CashPayIn  = "pay_in"
+	CashPayOut = "pay_out"
+)
+
+// CashDrawer is the cash a cashier is responsible for during a till
+// session. Expected cash is the opening float plus cash sales and pay-ins,
+// less pay-outs and cash refunds. While the drawer is open the cashier isn't shown the
+// totals, so their closing count is blind.
+type CashDrawer struct {
+	ID            int        `json:"id"`
+	TillSessionID int        `json:"till_session_id"`
+	TerminalID    int        `json:"terminal_id"`
+	TerminalName  string     `json:"terminal_name"`
+	StaffID       int        `json:"staff_id"`
+	StaffName     string     `json:"staff_name"`
+	Status        string     `json:"status"`
+	OpeningFloat  Money      `json:"opening_float"`
+	OpenedAt      time.Time  `json:"opened_at"`
+	ClosedAt      *time.Time `json:"closed_at"`
+	ClosedBy      string     `json:"closed_by,omitempty"`
+
+	CashSales   *Money `json:"cash_sales,omitempty"`   // Cash payments taken in the till session
+	CashRefunds *Money `json:"cash_refunds,omitempty"` // Cash refunds paid out in the till session
+	PayIns      *Money `json:"pay_ins,omitempty"`
+	PayOuts     *Money `json:"pay_outs,omitempty"`
+	Expected    *Money `json:"expected,omitempty"`
+	Counted     *Money `json:"counted,omitempty"`
+	OverShort   *Money `json:"over_short,omitempty"` // Counted less Expected; negative when short
+
+	Movements []CashMovement `json:"movements,omitempty"`
+}
+
+// CashMovement is cash put into (pay-in) or taken out of (pay-out) a drawer
+// other than for a sale, e.g. extra change or paying a delivery driver.
+type CashMovement struct {
+	ID        int       `json:"id"`
+	DrawerID  int       `json:"drawer_id"`
+	Kind      string    `json:"kind"`
+	Amount    Money     `json:"amount"`
+	Reason    string    `json:"reason"`
+	StaffID   int       `json:"staff_id"`
+	StaffName string    `json:"staff_name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OpenCashDrawerInput struct {
+	OpeningFloat Money `json:"opening_float"`
+}
+
+type CreateCashMovementInput struct {
+	Kind   string `json:"kind" binding:"required"` // pay_in or pay_out
+	Amount Money  `json:"amount" binding:"required"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+type CloseCashDrawerInput struct {
+	CountedAmount *Money `json:"counted_amount" binding:"required"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	CreditNoteVoid   = "void"   // Cancelled before payment
+	CreditNoteRefund = "refund" // Money returned after payment
+)
+
+// ReasonCodes are the accepted reasons for voids and refunds.
+var ReasonCodes = []string{
+	"customer_cancelled",
+	"wrong_item",
+	"quality_issue",
+	"long_wait",
+	"duplicate_order",
+	"pricing_error",
+	"other",
+}
+
+// CreditNote reverses all or part of an invoice. Amount excludes tax, like
+// Invoice.TotalAmount, and TaxAmount is the matching share of the invoice's
+// exclusive tax.
+type CreditNote struct {
+	ID         int              `json:"id"`
+	InvoiceID  int              `json:"invoice_id"`
+	Kind       string           `json:"kind"`
+	ReasonCode string           `json:"reason_code"`
+	Note       string           `json:"note"`
+	ApprovedBy string           `json:"approved_by"`
+	Amount     Money            `json:"amount"`
+	TaxAmount  Money            `json:"tax_amount"`
+	CreatedAt  time.Time        `json:"created_at"`
+	Items      []CreditNoteItem `json:"items"`
+
+	// Refunds only: the money paid back and how. RefundAmount is less than
+	// Amount plus TaxAmount when the order was only part paid.
+	RefundMethod  string `json:"refund_method,omitempty"` // cash, card or voucher
+	RefundAmount  Money  `json:"refund_amount,omitempty"`
+	TillSessionID *int   `json:"till_session_id,omitempty"` // The till whose drawer a cash refund came from
+}
+
+type CreditNoteItem struct {
+	ID            int   `json:"id"`
+	CreditNoteID  int   `json:"credit_note_id"`
+	InvoiceItemID int   `json:"invoice_item_id"`
+	Quantity      int   `json:"quantity"`
+	Amount        Money `json:"amount"`
+}
+
+type CreateCreditNoteInput struct {
+	ReasonCode string                      `json:"reason_code" binding:"required"`
+	Note       string                      `json:"note"`
+	ApprovedBy string                      `json:"-"`     // The logged in manager
+	Items      []CreateCreditNoteItemInput `json:"items"` // Empty reverses everything not yet reversed
+
+	// Refunds only: cash, card or voucher. Cash is paid out of the cash
+	// drawer of TillSessionID, which is set from the manager's till
+	// session and never taken from the client.
+	RefundMethod  string `json:"refund_method"`
+	TillSessionID *int   `json:"-"`
+}
+
+type CreateCreditNoteItemInput struct {
+	InvoiceItemID int `json:"invoice_item_id" binding:"required"`
+	Quantity      int `json:"quantity" binding:"required"`
+}
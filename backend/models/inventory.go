@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+)
+
+// Ingredient is something the kitchen keeps in stock, counted in Unit
+// (e.g. kg, l or each). It is low on stock once OnHand falls to
+// LowStockThreshold. Orders that need more than is on hand are refused.
+type Ingredient struct {
+	ID                int       `json:"id"`
+	Name              string    `json:"name"`
+	Unit              string    `json:"unit"`
+	OnHand            Quantity  `json:"on_hand"`
+	LowStockThreshold Quantity  `json:"low_stock_threshold"`
+	IsLowStock        bool      `json:"is_low_stock"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+type CreateIngredientInput struct {
+	Name              string   `json:"name" binding:"required"`
+	Unit              string   `json:"unit" binding:"required"`
+	OnHand            Quantity `json:"on_hand"`
+	LowStockThreshold Quantity `json:"low_stock_threshold"`
+}
+
+// UpdateIngredientInput changes an ingredient's details. Stock levels are
+// changed with AdjustStockInput so each change is recorded.
+type UpdateIngredientInput struct {
+	Name              *string   `json:"name"`
+	Unit              *string   `json:"unit"`
+	LowStockThreshold *Quantity `json:"low_stock_threshold"`
+}
+
+// AdjustStockInput changes an ingredient's stock by Change, or sets it to
+// Count after a stock take. Exactly one of them must be given.
+type AdjustStockInput struct {
+	Change *Quantity `json:"change"` // positive for deliveries, negative for waste
+	Count  *Quantity `json:"count"`
+	Reason string    `json:"reason" binding:"required"`
+}
+
+// RecipeLine is how much of an ingredient goes into one of an item, or
+// into one portion of a topping. Lines for the same ingredient add up, so a
+// pizza can use some cheese at every size plus extra on a large.
+type RecipeLine struct {
+	IngredientID   int      `json:"ingredient_id"`
+	IngredientName string   `json:"ingredient_name"`
+	Unit           string   `json:"unit"`
+	Size           *string  `json:"size"` // Pizza size the line is for; nil for every size
+	Quantity       Quantity `json:"quantity"`
+}
+
+type RecipeLineInput struct {
+	IngredientID int      `json:"ingredient_id"`
+	Size         string   `json:"size"` // pizzas only; "" applies to every size
+	Quantity     Quantity `json:"quantity"`
+}
+
+// SetRecipeInput replaces a recipe; no lines clears it.
+type SetRecipeInput struct {
+	Lines []RecipeLineInput `json:"lines"`
+}
+
+// StockShortage is a menu item (at a pizza size) or topping that can't be
+// made because there isn't enough of Ingredients for a single serving.
+type StockShortage struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Size        *string  `json:"size,omitempty"`
+	Ingredients []string `json:"ingredients"`
+}
+
+type StockShortages struct {
+	Items    []StockShortage `json:"items"`
+	Toppings []StockShortage `json:"toppings"`
+}
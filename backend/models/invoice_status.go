@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	InvoiceStatusOpen      = "open"
+	InvoiceStatusPreparing = "preparing"
+	InvoiceStatusReady     = "ready"
+	InvoiceStatusCompleted = "completed"
+	InvoiceStatusVoided    = "voided"
+	InvoiceStatusRefunded  = "refunded"
+)
+
+// InvoiceStatusChange records one transition of an invoice's status. The
+// first entry of every invoice has no FromStatus.
+type InvoiceStatusChange struct {
+	ID         int       `json:"id"`
+	InvoiceID  int       `json:"invoice_id"`
+	FromStatus *string   `json:"from_status"`
+	ToStatus   string    `json:"to_status"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+type UpdateInvoiceStatusInput struct {
+	Status string `json:"status" binding:"required"`
+}
@@ -4,13 +4,18 @@ import (
 	"time"
 )
 
+// Item is a menu item. IsAvailable is switched off by hand or, with SoldOut
+// set, automatically when the item can't be made from the ingredients in
+// stock or its StockCount has run down; it comes back on when restocked.
 type Item struct {
 	ID          int       `json:"id"`
 	Name        string    `json:"name"`
 	Category    string    `json:"category"`
 	Description string    `json:"description"`
 	IsAvailable bool      `json:"is_available"`
-	Price       *float64  `json:"price,omitempty"`
+	SoldOut     bool      `json:"sold_out"`
+	StockCount  *int      `json:"stock_count"` // How many are left of a limited special; nil if not counted
+	Price       *Money    `json:"price,omitempty"`
 	ImagePath   string    `json:"image_path"`
 	CreatedAt   time.Time `json:"created_at"`
 }
@@ -19,83 +24,117 @@ type PizzaBasePrice struct {
 	ID        int       `json:"id"`
 	ItemID    int       `json:"item_id"`
 	Size      string    `json:"size"`
-	Price     float64   `json:"price"`
+	Price     Money     `json:"price"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// Topping is a pizza topping. Like items, toppings are marked SoldOut and
+// unavailable while there isn't enough stock for a portion.
 type Topping struct {
 	ID          int       `json:"id"`
 	Name        string    `json:"name"`
-	Price       float64   `json:"price"`
+	Price       Money     `json:"price"`
 	IsAvailable bool      `json:"is_available"`
+	SoldOut     bool      `json:"sold_out"`
 	CreatedAt   time.Time `json:"created_at"`
 }
 
 type CreateItemInput struct {
-	Name        string   `json:"name" binding:"required"`
-	Category    string   `json:"category" binding:"required"`
-	Description string   `json:"description"`
-	Price       *float64 `json:"price"`
-	ImagePath   string   `json:"image_path"`
+	Name        string `json:"name" binding:"required"`
+	Category    string `json:"category" binding:"required"`
+	Description string `json:"description"`
+	Price       *Money `json:"price"`
+	ImagePath   string `json:"image_path"`
+	StockCount  *int   `json:"stock_count"`
 }
 
 type UpdateItemInput struct {
-	Name        *string  `json:"name"`
-	Description *string  `json:"description"`
-	IsAvailable *bool    `json:"is_available"`
-	Price       *float64 `json:"price"`
-	ImagePath   string   `json:"image_path"`
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	IsAvailable *bool   `json:"is_available"` // Also clears SoldOut; the item is sold out again if still short
+	Price       *Money  `json:"price"`
+	ImagePath   string  `json:"image_path"`
+	StockCount  *int    `json:"stock_count"` // A negative count stops counting
 }
 
 type CreatePizzaPrice struct {
-	ItemID int     `json:"item_id"`
-	Size   string  `json:"size"`
-	Price  float64 `json:"price"`
+	ItemID int    `json:"item_id"`
+	Size   string `json:"size"`
+	Price  Money  `json:"price"`
 }
 
 type UpdatePizzaPrice struct {
-	Size  string  `json:"size" binding:"required"`
-	Price float64 `json:"price" binding:"required"`
+	Size  string `json:"size" binding:"required"`
+	Price Money  `json:"price" binding:"required"`
 }
 
 type Invoice struct {
 	ID          int           `json:"id"`
 	OrderNo     string        `json:"order_no"`
-	TotalAmount float64       `json:"total_amount"`
-	TaxAmount   float64       `json:"tax_amount"`
+	TotalAmount Money         `json:"total_amount"`
+	TaxAmount   Money         `json:"tax_amount"` // Exclusive taxes charged on top of TotalAmount
 	Status      string        `json:"status"`
 	CreatedAt   time.Time     `json:"created_at"`
+	CashierID   *int          `json:"cashier_id"`  // Staff member who rang it up
+	TerminalID  *int          `json:"terminal_id"` // Set when rung up on a till with a PIN login
 	Items       []InvoiceItem `json:"items,omitempty"`
+	Taxes       []InvoiceTax  `json:"taxes,omitempty"`
+
+	StatusHistory []InvoiceStatusChange `json:"status_history,omitempty"`
+	CreditNotes   []CreditNote          `json:"credit_notes,omitempty"`
+
+	// Payment state: AmountDue is TotalAmount + TaxAmount less voids and
+	// refunds, and AmountPaid is what was paid less what was refunded
+	PaidAt     *time.Time `json:"paid_at"`
+	AmountDue  Money      `json:"amount_due"`
+	AmountPaid Money      `json:"amount_paid"`
+	BalanceDue Money      `json:"balance_due"`
+	Payments   []Payment  `json:"payments,omitempty"`
 }
 
 type InvoiceItem struct {
 	ID        int                  `json:"id"`
 	InvoiceID int                  `json:"invoice_id"`
+	ItemID    *int                 `json:"item_id"`
 	ItemName  string               `json:"item_name"`
+	Size      *string              `json:"size,omitempty"`
 	Quantity  int                  `json:"quantity"`
-	UnitPrice float64              `json:"unit_price"`
-	Subtotal  float64              `json:"subtotal"`
+	UnitPrice Money                `json:"unit_price"` // Base price of one item, excluding toppings
 	Toppings  []InvoiceItemTopping `json:"toppings,omitempty"`
+
+	// Breakdown of Subtotal: (UnitPrice + ToppingsPrice) * Quantity
+	ToppingsPrice  Money `json:"toppings_price"`  // Toppings on one item
+	BaseAmount     Money `json:"base_amount"`     // UnitPrice * Quantity
+	ToppingsAmount Money `json:"toppings_amount"` // ToppingsPrice * Quantity
+	Subtotal       Money `json:"subtotal"`
 }
 
 type InvoiceItemTopping struct {
-	ID        int     `json:"id"`
-	ToppingID int     `json:"topping_id"`
-	Name      string  `json:"name"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `json:"price"`
+	ID        int    `json:"id"`
+	ToppingID int    `json:"topping_id"`
+	Name      string `json:"name"`
+	Quantity  int    `json:"quantity"` // Per item
+	Price     Money  `json:"price"`
+	Subtotal  Money  `json:"subtotal"` // Price * Quantity * item quantity
 }
 
+// CreateInvoiceInput has no order number; the server allocates one when
+// the invoice is created.
 type CreateInvoiceInput struct {
-	OrderNo string                   `json:"order_no" binding:"required"`
-	Items   []CreateInvoiceItemInput `json:"items" binding:"required"`
+	Items []CreateInvoiceItemInput `json:"items" binding:"required"`
+
+	// Set from the logged in staff member, never taken from the client
+	CashierID  *int `json:"-"`
+	TerminalID *int `json:"-"`
 }
 
+// CreateInvoiceItemInput references a menu item; names and prices are
+// resolved by the server, never taken from the client.
 type CreateInvoiceItemInput struct {
-	ItemName  string                      `json:"item_name" binding:"required"`
-	Quantity  int                         `json:"quantity" binding:"required"`
-	UnitPrice float64                     `json:"unit_price" binding:"required"`
-	Toppings  []CreateInvoiceToppingInput `json:"toppings"`
+	ItemID   int                         `json:"item_id" binding:"required"`
+	Size     string                      `json:"size"` // required for pizzas
+	Quantity int                         `json:"quantity" binding:"required"`
+	Toppings []CreateInvoiceToppingInput `json:"toppings"`
 }
 
 type CreateInvoiceToppingInput struct {
@@ -105,5 +144,49 @@ type CreateInvoiceToppingInput struct {
 
 type PizzaWithPrices struct {
 	Item
-	Prices map[string]float64 `json:"prices"` // Will store prices for each size
+	Prices map[string]Money `json:"prices"` // Will store prices for each size
+}
+
+// InvoiceFilter narrows and pages the invoice list. When Cursor is set it
+// takes precedence over Page.
+type InvoiceFilter struct {
+	From       *time.Time
+	To         *time.Time // Exclusive
+	Status     string
+	OrderNo    string
+	MinTotal   *Money
+	MaxTotal   *Money
+	ItemName   string
+	CashierID  *int
+	TerminalID *int
+	Page       int
+	Limit      int
+	Cursor     string
+}
+
+type InvoicePage struct {
+	Data       []Invoice `json:"data"`
+	Total      int       `json:"total"`
+	Page       int       `json:"page,omitempty"`
+	Limit      int       `json:"limit"`
+	NextCursor *string   `json:"next_cursor"`
+}
+
+// InvoiceExportRow is one invoice line for spreadsheet export. Line fields
+// are nil for an invoice without lines.
+type InvoiceExportRow struct {
+	InvoiceID     int
+	OrderNo       string
+	CreatedAt     time.Time
+	Status        string
+	TotalAmount   Money
+	TaxAmount     Money
+	LineID        *int
+	ItemName      *string
+	Size          *string
+	Quantity      *int
+	UnitPrice     *Money
+	ToppingsPrice *Money
+	Subtotal      *Money
+	Toppings      string // e.g. "Olives x2 @ 380.00; Onions x1 @ 220.00"
 }
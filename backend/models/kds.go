@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	KDSTicketOpen  = "open"
+	KDSTicketReady = "ready"
+)
+
+// KDSTicket is the part of an order one kitchen station prepares.
+// ElapsedSeconds runs from when the order came in until the ticket was
+// bumped to ready, or until now while it is still open.
+type KDSTicket struct {
+	ID             int             `json:"id"`
+	InvoiceID      int             `json:"invoice_id"`
+	OrderNo        string          `json:"order_no"`
+	InvoiceStatus  string          `json:"invoice_status"`
+	Station        string          `json:"station"`
+	Status         string          `json:"status"`
+	CreatedAt      time.Time       `json:"created_at"`
+	ReadyAt        *time.Time      `json:"ready_at"`
+	ElapsedSeconds int             `json:"elapsed_seconds"`
+	Items          []KDSTicketItem `json:"items"`
+}
+
+type KDSTicketItem struct {
+	ID            int                  `json:"id"`
+	InvoiceItemID int                  `json:"invoice_item_id"`
+	ItemName      string               `json:"item_name"`
+	Size          *string              `json:"size,omitempty"`
+	Quantity      int                  `json:"quantity"`
+	Toppings      []InvoiceItemTopping `json:"toppings,omitempty"`
+	ReadyAt       *time.Time           `json:"ready_at"`
+}
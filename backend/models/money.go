@@ -0,0 +1,274 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in cents, matching the DECIMAL(10,2) columns exactly.
+// It marshals to a JSON number with two decimal places and scans from the
+// textual form Postgres returns for DECIMAL columns, so amounts never pass
+// through float64.
+//
+// Every operation that can produce fractions of a cent rounds half away
+// from zero ("half-up"), which is how receipts and tax returns round.
+type Money int64
+
+// Rate is a decimal with four places, used for tax rates (DECIMAL(10,4)).
+// A 5% rate is stored as 50000.
+type Rate int64
+
+// Quantity is a decimal with three places, used for stock levels and recipe
+// amounts (DECIMAL(12,3)), e.g. 0.125 kg of cheese is stored as 125.
+type Quantity int64
+
+const (
+	moneyScale    = 2
+	rateScale     = 4
+	quantityScale = 3
+)
+
+func ParseMoney(s string) (Money, error) {
+	v, err := parseFixed(s, moneyScale)
+	return Money(v), err
+}
+
+func ParseRate(s string) (Rate, error) {
+	v, err := parseFixed(s, rateScale)
+	return Rate(v), err
+}
+
+func ParseQuantity(s string) (Quantity, error) {
+	v, err := parseFixed(s, quantityScale)
+	return Quantity(v), err
+}
+
+func (m Money) String() string {
+	return formatFixed(int64(m), moneyScale)
+}
+
+func (r Rate) String() string {
+	return formatFixed(int64(r), rateScale)
+}
+
+func (q Quantity) String() string {
+	return formatFixed(int64(q), quantityScale)
+}
+
+// Mul multiplies by a count, e.g. a recipe amount by the number ordered.
+func (q Quantity) Mul(count int) Quantity {
+	return q * Quantity(count)
+}
+
+// Mul multiplies by a quantity; this never needs rounding.
+func (m Money) Mul(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// Percent returns rate percent of m, e.g. the exclusive tax on m.
+func (m Money) Percent(rate Rate) Money {
+	return Money(divRound(int64(m)*int64(rate), 100*pow10(rateScale)))
+}
+
+// PercentIncluded returns the part of m that is rate percent tax already
+// included in m, i.e. m - m/(1+rate/100).
+func (m Money) PercentIncluded(rate Rate) Money {
+	return Money(divRound(int64(m)*int64(rate), 100*pow10(rateScale)+int64(rate)))
+}
+
+// Share returns m * part / whole, for splitting an amount in proportion,
+// e.g. the tax on a partial refund.
+func (m Money) Share(part, whole int64) Money {
+	if whole == 0 {
+		return 0
+	}
+	return Money(divRound(int64(m)*part, whole))
+}
+
+// Money converts a rate used as a fixed amount to cents.
+func (r Rate) Money() Money {
+	return Money(divRound(int64(r), pow10(rateScale-moneyScale)))
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalFixed(data, moneyScale)
+	*m = Money(v)
+	return err
+}
+
+func (m *Money) Scan(src interface{}) error {
+	v, err := scanFixed(src, moneyScale)
+	*m = Money(v)
+	return err
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalFixed(data, rateScale)
+	*r = Rate(v)
+	return err
+}
+
+func (r *Rate) Scan(src interface{}) error {
+	v, err := scanFixed(src, rateScale)
+	*r = Rate(v)
+	return err
+}
+
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	return []byte(q.String()), nil
+}
+
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	v, err := unmarshalFixed(data, quantityScale)
+	*q = Quantity(v)
+	return err
+}
+
+func (q *Quantity) Scan(src interface{}) error {
+	v, err := scanFixed(src, quantityScale)
+	*q = Quantity(v)
+	return err
+}
+
+func (q Quantity) Value() (driver.Value, error) {
+	return q.String(), nil
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+// divRound divides rounding half away from zero.
+func divRound(num, den int64) int64 {
+	if den < 0 {
+		num, den = -num, -den
+	}
+	q, r := num/den, num%den
+	if r < 0 {
+		r = -r
+	}
+	if 2*r >= den {
+		if num < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+// parseFixed parses a decimal string into an integer with the given number
+// of decimal places, rounding any extra digits half away from zero.
+func parseFixed(s string, scale int) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("invalid decimal %q", s)
+	}
+
+	negative := false
+	digits := s
+	if digits[0] == '-' || digits[0] == '+' {
+		negative = digits[0] == '-'
+		digits = digits[1:]
+	}
+
+	whole, frac, _ := strings.Cut(digits, ".")
+	if whole == "" {
+		whole = "0"
+	}
+	for _, part := range []string{whole, frac} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, fmt.Errorf("invalid decimal %q", s)
+			}
+		}
+	}
+
+	roundUp := false
+	if len(frac) > scale {
+		roundUp = frac[scale] >= '5'
+		frac = frac[:scale]
+	}
+	frac += strings.Repeat("0", scale-len(frac))
+
+	v, err := strconv.ParseInt(whole+frac, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid decimal %q", s)
+	}
+	if roundUp {
+		v++
+	}
+	if negative {
+		v = -v
+	}
+	return v, nil
+}
+
+func formatFixed(v int64, scale int) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	p := pow10(scale)
+	return fmt.Sprintf("%s%d.%0*d", sign, v/p, scale, v%p)
+}
+
+func unmarshalFixed(data []byte, scale int) (int64, error) {
+	s := string(data)
+	if s == "null" {
+		return 0, nil
+	}
+	// Accept both JSON numbers and quoted decimal strings
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	if strings.ContainsAny(s, "eE") {
+		// Exponent notation from JavaScript clients, e.g. 1e-7
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid decimal %q", s)
+		}
+		s = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return parseFixed(s, scale)
+}
+
+func scanFixed(src interface{}, scale int) (int64, error) {
+	switch v := src.(type) {
+	case []byte:
+		return parseFixed(string(v), scale)
+	case string:
+		return parseFixed(v, scale)
+	case int64:
+		return v * pow10(scale), nil
+	case float64:
+		return parseFixed(strconv.FormatFloat(v, 'f', -1, 64), scale)
+	case nil:
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("cannot scan %T into a decimal", src)
+	}
+}
@@ -0,0 +1,222 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"12", 1200, false},
+		{"12.5", 1250, false},
+		{"12.50", 1250, false},
+		{".99", 99, false},
+		{"-3.10", -310, false},
+		{"+3.10", 310, false},
+		{" 7.25 ", 725, false},
+		{"0.004", 0, false},
+		{"0.005", 1, false},
+		{"2.675", 268, false},
+		{"-2.675", -268, false},
+		{"9.999", 1000, false},
+		{"", 0, true},
+		{"abc", 0, true},
+		{"1.2.3", 0, true},
+		{"1,50", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMoney(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{1250, "12.50"},
+		{-310, "-3.10"},
+		{-5, "-0.05"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{`12.5`, 1250},
+		{`"12.50"`, 1250},
+		{`0.1`, 10},
+		{`1e-7`, 0},
+		{`null`, 0},
+	}
+
+	for _, tt := range tests {
+		var got Money
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil {
+			t.Errorf("Unmarshal(%s) error = %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+
+	data, err := json.Marshal(struct{ Total Money }{1999})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"Total":19.99}` {
+		t.Errorf("Marshal = %s, want {\"Total\":19.99}", data)
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		amount Money
+		rate   string
+		want   Money
+	}{
+		{1000, "5", 50},
+		{1999, "8.25", 165},   // 164.9175
+		{1010, "5", 51},       // 50.5 rounds up
+		{-1010, "5", -51},     // and away from zero
+		{333, "10", 33},       // 33.3
+		{1, "12.5", 0},        // 0.125
+		{4, "12.5", 1},        // 0.5
+		{123456, "0.0001", 0}, // 0.123456
+	}
+
+	for _, tt := range tests {
+		rate, err := ParseRate(tt.rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tt.amount.Percent(rate); got != tt.want {
+			t.Errorf("Money(%d).Percent(%s) = %d, want %d", tt.amount, tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyPercentIncluded(t *testing.T) {
+	tests := []struct {
+		amount Money
+		rate   string
+		want   Money
+	}{
+		{1050, "5", 50},
+		{1200, "20", 200},
+		{999, "20", 167},  // 166.5 rounds up
+		{1000, "7.5", 70}, // 69.767...
+		{-1200, "20", -200},
+	}
+
+	for _, tt := range tests {
+		rate, err := ParseRate(tt.rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := tt.amount.PercentIncluded(rate)
+		if got != tt.want {
+			t.Errorf("Money(%d).PercentIncluded(%s) = %d, want %d", tt.amount, tt.rate, got, tt.want)
+		}
+		// The net amount plus the tax on it gives back the gross amount
+		// to within the cent lost to rounding.
+		net := tt.amount - got
+		if diff := net + net.Percent(rate) - tt.amount; diff < -1 || diff > 1 {
+			t.Errorf("Money(%d): net plus tax is off by %d cents", tt.amount, diff)
+		}
+	}
+}
+
+func TestMoneyShare(t *testing.T) {
+	tests := []struct {
+		amount      Money
+		part, whole int64
+		want        Money
+	}{
+		{1000, 1, 2, 500},
+		{1000, 1, 3, 333},
+		{1000, 2, 3, 667},
+		{1, 1, 2, 1},
+		{-1, 1, 2, -1},
+		{1000, 0, 3, 0},
+		{1000, 3, 3, 1000},
+		{1000, 1, 0, 0},
+	}
+
+	for _, tt := range tests {
+		got := tt.amount.Share(tt.part, tt.whole)
+		if got != tt.want {
+			t.Errorf("Money(%d).Share(%d, %d) = %d, want %d", tt.amount, tt.part, tt.whole, got, tt.want)
+		}
+	}
+}
+
+func TestRateMoney(t *testing.T) {
+	tests := []struct {
+		rate string
+		want Money
+	}{
+		{"1.5", 150},
+		{"0.995", 100},
+		{"0.994", 99},
+		{"2", 200},
+	}
+
+	for _, tt := range tests {
+		rate, err := ParseRate(tt.rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := rate.Money(); got != tt.want {
+			t.Errorf("Rate(%s).Money() = %d, want %d", tt.rate, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want Money
+	}{
+		{[]byte("12.34"), 1234},
+		{"0.10", 10},
+		{int64(3), 300},
+		{0.1 + 0.2, 30},
+		{nil, 0},
+	}
+
+	for _, tt := range tests {
+		var got Money
+		if err := got.Scan(tt.src); err != nil {
+			t.Errorf("Scan(%v) error = %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Scan(%v) = %d, want %d", tt.src, got, tt.want)
+		}
+	}
+}
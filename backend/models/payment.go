@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	PaymentCash    = "cash"
+	PaymentCard    = "card"
+	PaymentVoucher = "voucher"
+)
+
+// Payment is one tender towards an invoice. Amount is what was applied to
+// the invoice; for cash, Tendered is what the customer handed over and
+// Change is what was given back.
+type Payment struct {
+	ID        int       `json:"id"`
+	InvoiceID int       `json:"invoice_id"`
+	Method    string    `json:"method"`
+	Amount    Money     `json:"amount"`
+	Tendered  Money     `json:"tendered"`
+	Change    Money     `json:"change"`
+	Reference string    `json:"reference"` // Card authorisation or voucher code
+	CreatedAt time.Time `json:"created_at"`
+
+	TillSessionID *int `json:"till_session_id"` // Set when taken on a till with a PIN login
+}
+
+// CreatePaymentInput records one or more tenders at once, e.g. part card
+// and part cash.
+type CreatePaymentInput struct {
+	Tenders []TenderInput `json:"tenders" binding:"required"`
+
+	// Set from the cashier's till session, never taken from the client.
+	// Cash taken in a till session goes into its cash drawer.
+	TillSessionID *int `json:"-"`
+}
+
+type TenderInput struct {
+	Method    string `json:"method" binding:"required"`
+	Amount    Money  `json:"amount" binding:"required"`
+	Reference string `json:"reference"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	PrintTargetReceipt = "receipt"
+	PrintTargetKitchen = "kitchen"
+)
+
+const (
+	PrintJobQueued  = "queued"
+	PrintJobPrinted = "printed"
+	PrintJobFailed  = "failed"
+)
+
+// PrintJob is an invoice sent to a receipt or kitchen printer. Jobs are
+// kept in memory and don't survive a restart.
+type PrintJob struct {
+	ID        int        `json:"id"`
+	InvoiceID int        `json:"invoice_id"`
+	OrderNo   string     `json:"order_no"`
+	Target    string     `json:"target"`
+	Printer   string     `json:"printer"`
+	Status    string     `json:"status"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"last_error,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	PrintedAt *time.Time `json:"printed_at"`
+}
+
+type PrintInvoiceInput struct {
+	Target string `json:"target" binding:"required"` // receipt or kitchen
+}
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	ReportTypeX = "x" // Running snapshot of the open period
+	ReportTypeZ = "z" // End-of-day close
+)
+
+// SalesReport summarises everything that happened in a period. Closing a
+// Z report stamps every invoice, tender, void and refund not yet in one
+// with its z_report_id, and the report counts exactly those rows; an X
+// report counts the rows with no z_report_id yet. Something still being
+// committed as a Z report closes lands in the next period, and closing a
+// period never changes an earlier report.
+type SalesReport struct {
+	ID          *int       `json:"id,omitempty"`
+	Type        string     `json:"type"`
+	PeriodStart *time.Time `json:"period_start"` // nil before the first Z report
+	PeriodEnd   time.Time  `json:"period_end"`
+	ClosedBy    string     `json:"closed_by,omitempty"`
+
+	OrderCount int           `json:"order_count"`
+	GrossSales Money         `json:"gross_sales"` // Before tax
+	Tax        Money         `json:"tax"`         // Exclusive tax charged
+	Taxes      []TaxTotal    `json:"taxes"`       // By rule, including inclusive taxes
+	Voids      CreditTotal   `json:"voids"`
+	Refunds    CreditTotal   `json:"refunds"`
+	NetSales   Money         `json:"net_sales"` // GrossSales less voids and refunds
+	NetTax     Money         `json:"net_tax"`   // Tax less voids and refunds
+	Tenders    []TenderTotal `json:"tenders"`
+
+	// Cash drawers closed in the period, and what they were over or short
+	// by in total
+	CashDrawers     []CashDrawer `json:"cash_drawers"`
+	CashOverShort   Money        `json:"cash_over_short"`
+	OpenCashDrawers int          `json:"open_cash_drawers"` // Open when the period ended, so not counted in it
+}
+
+type TaxTotal struct {
+	Name      string `json:"name"`
+	Inclusive bool   `json:"inclusive"`
+	Amount    Money  `json:"amount"`
+}
+
+type CreditTotal struct {
+	Count     int   `json:"count"`
+	Amount    Money `json:"amount"`
+	TaxAmount Money `json:"tax_amount"`
+}
+
+type TenderTotal struct {
+	Method   string `json:"method"`
+	Count    int    `json:"count"`
+	Amount   Money  `json:"amount"` // Applied to invoices
+	Tendered Money  `json:"tendered"`
+	Change   Money  `json:"change"`
+}
+
+type CloseZReportInput struct {
+	ClosedBy string `json:"-"` // The logged in manager
+}
+
+// SalesAnalytics breaks sales down over a date range, net of voids and
+// refunds.
+type SalesAnalytics struct {
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Items    []ItemSales    `json:"items"`
+	Sizes    []SizeSales    `json:"sizes"`
+	Toppings []ToppingSales `json:"toppings"`
+	Hours    []PeriodSales  `json:"hours"`    // Period is the hour of day, 0-23
+	Weekdays []PeriodSales  `json:"weekdays"` // Period is the day of week, 0 = Sunday
+}
+
+type ItemSales struct {
+	ItemName string `json:"item_name"`
+	Quantity int    `json:"quantity"`
+	Orders   int    `json:"orders"`
+	Sales    Money  `json:"sales"`
+}
+
+type SizeSales struct {
+	Size     string `json:"size"`
+	Quantity int    `json:"quantity"`
+	Sales    Money  `json:"sales"`
+}
+
+type ToppingSales struct {
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"` // Portions, counting every item on the line
+	Pizzas   int    `json:"pizzas"`
+	Sales    Money  `json:"sales"`
+}
+
+type PeriodSales struct {
+	Period int   `json:"period"`
+	Orders int   `json:"orders"`
+	Sales  Money `json:"sales"`
+}
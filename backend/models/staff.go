@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	RoleCashier = "cashier"
+	RoleKitchen = "kitchen"
+	RoleManager = "manager"
+	RoleAdmin   = "admin"
+)
+
+var Roles = []string{RoleCashier, RoleKitchen, RoleManager, RoleAdmin}
+
+type Staff struct {
+	ID        int       `json:"id"`
+	Username  string    `json:"username"`
+	Name      string    `json:"name"`
+	Role      string    `json:"role"`
+	HasPIN    bool      `json:"has_pin"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LoginInput struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// Session is returned on login. The token goes in the Authorization header
+// as "Bearer <token>". TillSession is set for PIN logins on a terminal.
+type Session struct {
+	Token       string       `json:"token"`
+	ExpiresAt   time.Time    `json:"expires_at"`
+	Staff       Staff        `json:"staff"`
+	TillSession *TillSession `json:"till_session,omitempty"`
+}
+
+type CreateStaffInput struct {
+	Username string `json:"username" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	PIN      string `json:"pin"`
+}
+
+type UpdateStaffInput struct {
+	Name     *string `json:"name"`
+	Role     *string `json:"role"`
+	Password *string `json:"password"`
+	PIN      *string `json:"pin"` // "" removes the PIN
+	IsActive *bool   `json:"is_active"`
+}
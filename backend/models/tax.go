@@ -0,0 +1,57 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	TaxKindPercentage = "percentage"
+	TaxKindFixed      = "fixed"
+)
+
+// TaxRule is a named tax or charge applied to invoices. Percentage rules use
+// Rate as a percent of the taxable amount, fixed rules charge Rate once per
+// invoice. Inclusive rules are already part of menu prices, so they are
+// recorded on the invoice but not added to the amount due.
+type TaxRule struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Rate      Rate      `json:"rate"`
+	Inclusive bool      `json:"inclusive"`
+	Category  *string   `json:"category"` // nil applies to every category
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateTaxRuleInput struct {
+	Name      string  `json:"name" binding:"required"`
+	Kind      string  `json:"kind" binding:"required"`
+	Rate      *Rate   `json:"rate" binding:"required"`
+	Inclusive bool    `json:"inclusive"`
+	Category  *string `json:"category"`
+	IsActive  *bool   `json:"is_active"`
+}
+
+type UpdateTaxRuleInput struct {
+	Name      *string `json:"name"`
+	Kind      *string `json:"kind"`
+	Rate      *Rate   `json:"rate"`
+	Inclusive *bool   `json:"inclusive"`
+	Category  *string `json:"category"` // "" clears the category
+	IsActive  *bool   `json:"is_active"`
+}
+
+// InvoiceTax records a tax rule as it was applied to an invoice.
+type InvoiceTax struct {
+	ID            int     `json:"id"`
+	InvoiceID     int     `json:"invoice_id"`
+	TaxRuleID     *int    `json:"tax_rule_id"`
+	Name          string  `json:"name"`
+	Kind          string  `json:"kind"`
+	Rate          Rate    `json:"rate"`
+	Inclusive     bool    `json:"inclusive"`
+	Category      *string `json:"category"` // The rule's category when it was applied
+	TaxableAmount Money   `json:"taxable_amount"`
+	Amount        Money   `json:"amount"`
+}
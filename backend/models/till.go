@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	TillSessionActive = "active"
+	TillSessionLocked = "locked"
+	TillSessionClosed = "closed"
+)
+
+// Terminal is a till that cashiers clock onto.
+type Terminal struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	IsActive  bool      `json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateTerminalInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// TillSession is a cashier clocked onto a terminal. Only one session per
+// terminal is active at a time; switching cashiers locks the others until
+// their cashier enters their PIN again.
+type TillSession struct {
+	ID             int        `json:"id"`
+	TerminalID     int        `json:"terminal_id"`
+	TerminalName   string     `json:"terminal_name"`
+	StaffID        int        `json:"staff_id"`
+	StaffName      string     `json:"staff_name"`
+	Status         string     `json:"status"`
+	OpenedAt       time.Time  `json:"opened_at"`
+	LastActivityAt time.Time  `json:"last_activity_at"`
+	LockedAt       *time.Time `json:"locked_at"`
+	ClosedAt       *time.Time `json:"closed_at"`
+}
+
+type PINLoginInput struct {
+	Username string `json:"username" binding:"required"`
+	PIN      string `json:"pin" binding:"required"`
+}
@@ -0,0 +1,52 @@
+package receipt
+
+import (
+	"bufio"
+	"io"
+)
+
+// ESCPOSWidth is how many characters fit on a line of an 80mm printer in
+// its default font.
+const ESCPOSWidth = 48
+
+// ESC/POS commands used to format receipts.
+var (
+	escInit        = []byte{0x1b, '@'}
+	escAlignLeft   = []byte{0x1b, 'a', 0}
+	escAlignCenter = []byte{0x1b, 'a', 1}
+	escBoldOff     = []byte{0x1b, 'E', 0}
+	escBoldOn      = []byte{0x1b, 'E', 1}
+	escSizeNormal  = []byte{0x1d, '!', 0x00}
+	escSizeDouble  = []byte{0x1d, '!', 0x11} // Double width and height
+	escFeedAndCut  = []byte{0x1b, 'd', 4, 0x1d, 'V', 'B', 0}
+)
+
+// WriteESCPOS renders lines as an ESC/POS byte stream, ending with a paper
+// feed and cut.
+func WriteESCPOS(w io.Writer, lines []Line) error {
+	b := bufio.NewWriter(w)
+	b.Write(escInit)
+
+	for _, line := range lines {
+		if line.Center {
+			b.Write(escAlignCenter)
+		} else {
+			b.Write(escAlignLeft)
+		}
+		if line.Bold {
+			b.Write(escBoldOn)
+		} else {
+			b.Write(escBoldOff)
+		}
+		if line.Large {
+			b.Write(escSizeDouble)
+		} else {
+			b.Write(escSizeNormal)
+		}
+		b.WriteString(line.Text)
+		b.WriteByte('\n')
+	}
+
+	b.Write(escFeedAndCut)
+	return b.Flush()
+}
@@ -0,0 +1,279 @@
+// Package receipt lays out invoices as fixed-width text and renders that
+// layout as PDF or as ESC/POS for thermal printers.
+package receipt
+
+import (
+	"fmt"
+	"pizza-shop/config"
+	"pizza-shop/models"
+	"strings"
+	"unicode/utf8"
+)
+
+// Line is one line of a receipt laid out for a monospaced font. Text never
+// exceeds the width the layout was built for; Large text is printed at
+// double size and so never exceeds half of it.
+type Line struct {
+	Text   string
+	Bold   bool
+	Center bool
+	Large  bool
+}
+
+// layout builds up receipt lines for a given width in characters.
+type layout struct {
+	width int
+	lines []Line
+}
+
+func (l *layout) text(text string) {
+	for _, part := range wrap(text, l.width) {
+		l.lines = append(l.lines, Line{Text: part})
+	}
+}
+
+func (l *layout) bold(text string) {
+	for _, part := range wrap(text, l.width) {
+		l.lines = append(l.lines, Line{Text: part, Bold: true})
+	}
+}
+
+func (l *layout) centered(text string, bold bool) {
+	for _, part := range wrap(text, l.width) {
+		l.lines = append(l.lines, Line{Text: part, Bold: bold, Center: true})
+	}
+}
+
+func (l *layout) large(text string) {
+	for _, part := range wrap(text, l.width/2) {
+		l.lines = append(l.lines, Line{Text: part, Bold: true, Center: true, Large: true})
+	}
+}
+
+func (l *layout) rule() {
+	l.lines = append(l.lines, Line{Text: strings.Repeat("-", l.width)})
+}
+
+func (l *layout) blank() {
+	l.lines = append(l.lines, Line{})
+}
+
+// pair prints label on the left and value on the right, wrapping the label
+// if both don't fit on one line. A value too wide to share a line with the
+// label goes on lines of its own, aligned right.
+func (l *layout) pair(label, value string, bold bool) {
+	value = strings.Map(printable, value)
+	valueWidth := utf8.RuneCountInString(value)
+	if valueWidth > l.width-2 {
+		for _, part := range wrap(label, l.width) {
+			l.lines = append(l.lines, Line{Text: part, Bold: bold})
+		}
+		for _, part := range wrap(value, l.width) {
+			l.lines = append(l.lines, Line{Text: padLeft(part, l.width), Bold: bold})
+		}
+		return
+	}
+
+	parts := wrap(label, l.width-valueWidth-1)
+	for i, part := range parts {
+		line := Line{Text: part, Bold: bold}
+		if i == len(parts)-1 {
+			line.Text = part + padLeft(value, l.width-utf8.RuneCountInString(part))
+		}
+		l.lines = append(l.lines, line)
+	}
+}
+
+// padLeft right-aligns text in width characters. Text already that wide is
+// returned as it is.
+func padLeft(text string, width int) string {
+	if n := utf8.RuneCountInString(text); n < width {
+		return strings.Repeat(" ", width-n) + text
+	}
+	return text
+}
+
+const (
+	qtyWidth    = 4
+	amountWidth = 10
+)
+
+// itemRow prints one row of the item table: name, quantity and amount.
+func (l *layout) itemRow(name, qty, amount string) {
+	nameWidth := l.width - qtyWidth - amountWidth
+	parts := wrap(name, nameWidth)
+	for i, part := range parts {
+		text := part
+		if i == 0 {
+			text = fmt.Sprintf("%-*s%*s%*s", nameWidth, part, qtyWidth, qty, amountWidth, amount)
+		}
+		l.lines = append(l.lines, Line{Text: text})
+	}
+}
+
+// Receipt lays out a customer receipt for invoice, which should have its
+// items loaded.
+func Receipt(invoice *models.Invoice, width int) []Line {
+	shop := config.Shop
+	l := &layout{width: width}
+
+	l.centered(shop.Name, true)
+	l.centered(shop.Address, false)
+	l.centered("Tel: "+shop.Phone, false)
+	l.rule()
+	l.text("Order #: " + invoice.OrderNo)
+	l.text("Date: " + invoice.CreatedAt.Format("2006-01-02 15:04"))
+	switch invoice.Status {
+	case models.InvoiceStatusVoided, models.InvoiceStatusRefunded:
+		l.centered("*** "+strings.ToUpper(invoice.Status)+" ***", true)
+	}
+	l.rule()
+
+	l.itemRow("Item", "Qty", "Amount")
+	for _, item := range invoice.Items {
+		l.itemRow(itemName(item), fmt.Sprint(item.Quantity), item.BaseAmount.String())
+		for _, topping := range item.Toppings {
+			name := "  + " + topping.Name
+			if topping.Quantity > 1 {
+				name += fmt.Sprintf(" x%d", topping.Quantity)
+			}
+			l.itemRow(name, "", topping.Subtotal.String())
+		}
+	}
+	l.rule()
+
+	money := func(amount models.Money) string {
+		return shop.Currency + " " + amount.String()
+	}
+
+	l.pair("Subtotal", money(invoice.TotalAmount), false)
+	for _, tax := range invoice.Taxes {
+		label := taxLabel(tax)
+		if tax.Inclusive {
+			label = "Incl. " + label
+		}
+		l.pair(label, money(tax.Amount), false)
+	}
+	l.pair("Total", money(invoice.TotalAmount+invoice.TaxAmount), true)
+
+	var refunds []models.CreditNote
+	for _, note := range invoice.CreditNotes {
+		label := "Voided"
+		if note.Kind == models.CreditNoteRefund {
+			label = "Returned"
+			refunds = append(refunds, note)
+		}
+		l.pair(label, money(-(note.Amount + note.TaxAmount)), false)
+	}
+	if len(invoice.CreditNotes) > 0 {
+		l.pair("Amount due", money(invoice.AmountDue), true)
+	}
+
+	if len(invoice.Payments) > 0 {
+		l.rule()
+		for _, payment := range invoice.Payments {
+			label := strings.ToUpper(payment.Method[:1]) + payment.Method[1:]
+			if payment.Reference != "" {
+				label += " (" + payment.Reference + ")"
+			}
+			l.pair(label, money(payment.Tendered), false)
+			if payment.Change > 0 {
+				l.pair("Change", money(payment.Change), false)
+			}
+		}
+		for _, note := range refunds {
+			label := "Refunded"
+			if note.RefundMethod != "" {
+				label += " (" + note.RefundMethod + ")"
+			}
+			l.pair(label, money(-note.RefundAmount), false)
+		}
+		l.pair("Paid", money(invoice.AmountPaid), true)
+	}
+	if invoice.BalanceDue > 0 {
+		l.pair("Balance due", money(invoice.BalanceDue), true)
+	}
+
+	l.blank()
+	l.centered("Thank you for your purchase!", false)
+	l.centered("Please visit again", false)
+
+	return l.lines
+}
+
+// KitchenTicket lays out the items of an invoice for the kitchen, without
+// prices.
+func KitchenTicket(invoice *models.Invoice, width int) []Line {
+	l := &layout{width: width}
+
+	l.centered("KITCHEN", true)
+	l.large("#" + invoice.OrderNo)
+	l.text("Time: " + invoice.CreatedAt.Format("2006-01-02 15:04"))
+	if invoice.Status == models.InvoiceStatusVoided {
+		l.centered("*** VOIDED ***", true)
+	}
+	l.rule()
+
+	for _, item := range invoice.Items {
+		l.bold(fmt.Sprintf("%d x %s", item.Quantity, itemName(item)))
+		for _, topping := range item.Toppings {
+			name := "    + " + topping.Name
+			if topping.Quantity > 1 {
+				name += fmt.Sprintf(" x%d", topping.Quantity)
+			}
+			l.text(name)
+		}
+	}
+	l.rule()
+
+	return l.lines
+}
+
+func itemName(item models.InvoiceItem) string {
+	if item.Size != nil {
+		return fmt.Sprintf("%s (%s)", item.ItemName, *item.Size)
+	}
+	return item.ItemName
+}
+
+// taxLabel names a tax the way customers expect to see it, e.g. "VAT 5%".
+func taxLabel(tax models.InvoiceTax) string {
+	if tax.Kind != models.TaxKindPercentage {
+		return tax.Name
+	}
+	rate := strings.TrimRight(strings.TrimRight(tax.Rate.String(), "0"), ".")
+	return fmt.Sprintf("%s %s%%", tax.Name, rate)
+}
+
+// wrap breaks text into lines of at most width characters, preferring to
+// break at spaces. It always returns at least one line.
+func wrap(text string, width int) []string {
+	text = strings.Map(printable, text)
+	if width < 1 {
+		width = 1
+	}
+
+	var lines []string
+	runes := []rune(text)
+	for len(runes) > width {
+		cut := width
+		for i := width; i > 0; i-- {
+			if runes[i] == ' ' {
+				cut = i
+				break
+			}
+		}
+		lines = append(lines, strings.TrimRight(string(runes[:cut]), " "))
+		runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+	}
+	return append(lines, string(runes))
+}
+
+// printable keeps receipts to printable ASCII, which every printer code page
+// and the standard PDF fonts agree on.
+func printable(r rune) rune {
+	if r < ' ' || r > '~' {
+		return '?'
+	}
+	return r
+}
@@ -0,0 +1,116 @@
+package receipt
+
+import (
+	"pizza-shop/config"
+	"pizza-shop/models"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{"", 10, []string{""}},
+		{"Margherita", 10, []string{"Margherita"}},
+		{"Large Margherita", 10, []string{"Large", "Margherita"}},
+		{"Quattro Formaggi", 8, []string{"Quattro", "Formaggi"}},
+		{"Pepperoni", 4, []string{"Pepp", "eron", "i"}},
+		{"Crème brûlée", 6, []string{"Cr?me", "br?l?e"}},
+		{"abc", 0, []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		got := wrap(tt.text, tt.width)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("wrap(%q, %d) = %q, want %q", tt.text, tt.width, got, tt.want)
+		}
+	}
+}
+
+func TestPair(t *testing.T) {
+	tests := []struct {
+		label, value string
+		want         []string
+	}{
+		{"Total", "Rs 12.00", []string{"Total           Rs 12.00"}},
+		{"Café", "Rs 1.50", []string{"Caf?             Rs 1.50"}},
+		{"Card (ref 1234 5678)", "Rs 9.00", []string{"Card (ref 1234", "5678)            Rs 9.00"}},
+		{"Paid", "Rs 123456789012345678901.00", []string{"Paid", "                      Rs", "123456789012345678901.00"}},
+	}
+	for _, tt := range tests {
+		l := &layout{width: 24}
+		l.pair(tt.label, tt.value, false)
+		var got []string
+		for _, line := range l.lines {
+			got = append(got, line.Text)
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("pair(%q, %q) = %q, want %q", tt.label, tt.value, got, tt.want)
+		}
+	}
+}
+
+// TestLayoutWidths lays out an order with long and non-ASCII names at each
+// paper width and checks nothing runs off the edge.
+func TestLayoutWidths(t *testing.T) {
+	shop := config.Shop
+	t.Cleanup(func() { config.Shop = shop })
+	config.Shop = config.ShopDetails{
+		Name:     "Pizzería Über Gut",
+		Address:  "Unit 4, The Long Parade Shopping Centre, Somewhere Quite Far Away",
+		Phone:    "(123) 456-7890",
+		Currency: "Rs",
+	}
+
+	large := "large"
+	invoice := &models.Invoice{
+		OrderNo:     "20261017-000123",
+		TotalAmount: 12345678901,
+		TaxAmount:   1234567890,
+		Status:      models.InvoiceStatusRefunded,
+		CreatedAt:   time.Date(2026, 10, 17, 18, 30, 0, 0, time.UTC),
+		Items: []models.InvoiceItem{{
+			ItemName:   "Extra Special Four Seasons Pizza With Jalapeños",
+			Size:       &large,
+			Quantity:   12,
+			BaseAmount: 99999999,
+			Toppings: []models.InvoiceItemTopping{
+				{Name: "Extra Mozzarella di Bufala Campana", Quantity: 2, Subtotal: 4800},
+			},
+		}},
+		Taxes: []models.InvoiceTax{
+			{Name: "Goods and Services Tax (Federal)", Rate: 170000, Amount: 1234567890},
+		},
+		CreditNotes: []models.CreditNote{
+			{Kind: models.CreditNoteRefund, Amount: 12345678901, TaxAmount: 1234567890,
+				RefundMethod: models.PaymentVoucher, RefundAmount: 13580246791},
+		},
+		Payments: []models.Payment{
+			{Method: models.PaymentCard, Reference: "AUTH 0000 1111 2222 3333", Amount: 13580246791, Tendered: 13580246791},
+		},
+	}
+
+	for _, width := range []int{32, ESCPOSWidth, PDFWidth} {
+		for name, lines := range map[string][]Line{
+			"receipt":        Receipt(invoice, width),
+			"kitchen ticket": KitchenTicket(invoice, width),
+		} {
+			for _, line := range lines {
+				limit := width
+				if line.Large {
+					limit = width / 2
+				}
+				if n := utf8.RuneCountInString(line.Text); n > limit {
+					t.Errorf("%s at width %d: %q is %d characters, want at most %d", name, width, line.Text, n, limit)
+				}
+				if strings.ContainsFunc(line.Text, func(r rune) bool { return printable(r) != r }) {
+					t.Errorf("%s at width %d: %q is not printable ASCII", name, width, line.Text)
+				}
+			}
+		}
+	}
+}
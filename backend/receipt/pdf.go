@@ -0,0 +1,82 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// PDFWidth is how many characters fit on a line of a PDF receipt.
+const PDFWidth = 42
+
+// The PDF page matches an 80mm till roll; its height grows with the receipt.
+const (
+	pdfPageWidth = 226.77 // 80mm in points
+	pdfFontSize  = 8
+	pdfCharWidth = pdfFontSize * 0.6 // Courier advances 600/1000 em
+	pdfLeading   = 10
+	pdfMargin    = 12
+)
+
+// WritePDF renders lines as a single-page PDF using the standard Courier
+// fonts, so no font needs to be embedded. Large lines are printed at the
+// normal size.
+func WritePDF(w io.Writer, lines []Line) error {
+	height := float64(2*pdfMargin + len(lines)*pdfLeading)
+	left := (pdfPageWidth - PDFWidth*pdfCharWidth) / 2
+
+	var content bytes.Buffer
+	for i, line := range lines {
+		if line.Text == "" {
+			continue
+		}
+		font := "F1"
+		if line.Bold {
+			font = "F2"
+		}
+		x := left
+		if n := utf8.RuneCountInString(line.Text); line.Center && n < PDFWidth {
+			x += float64(PDFWidth-n) * pdfCharWidth / 2
+		}
+		y := height - pdfMargin - float64(i+1)*pdfLeading + 2
+		fmt.Fprintf(&content, "BT /%s %d Tf %.2f %.2f Td (%s) Tj ET\n", font, pdfFontSize, x, y, pdfEscape(line.Text))
+	}
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /F1 4 0 R /F2 5 0 R >> >> /Contents 6 0 R >>", pdfPageWidth, height),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+	}
+
+	// Objects are numbered from 1 and the cross-reference table needs the
+	// byte offset of each
+	var doc bytes.Buffer
+	doc.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = doc.Len()
+		fmt.Fprintf(&doc, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := doc.Len()
+	fmt.Fprintf(&doc, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&doc, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&doc, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+var pdfEscaper = strings.NewReplacer(`\`, `\\`, `(`, `\(`, `)`, `\)`)
+
+func pdfEscape(text string) string {
+	return pdfEscaper.Replace(text)
+}
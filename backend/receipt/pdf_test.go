@@ -0,0 +1,84 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestWritePDF checks the structure a PDF reader relies on: the header and
+// trailer, cross-reference offsets that point at their objects and a content
+// stream of the declared length.
+func TestWritePDF(t *testing.T) {
+	lines := []Line{
+		{Text: "PIZZA SHOP", Bold: true, Center: true},
+		{Text: "Garlic bread (vegan)      1      4.50"},
+		{},
+		{Text: `C:\till`, Large: true},
+		{Text: strings.Repeat("=", PDFWidth+6), Center: true},
+	}
+	var buf bytes.Buffer
+	if err := WritePDF(&buf, lines); err != nil {
+		t.Fatal(err)
+	}
+	doc := buf.String()
+
+	if !strings.HasPrefix(doc, "%PDF-1.4\n") {
+		t.Errorf("document starts %q, want a PDF 1.4 header", doc[:min(len(doc), 9)])
+	}
+	if !strings.HasSuffix(doc, "%%EOF\n") {
+		t.Error("document does not end with the EOF marker")
+	}
+
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(doc)
+	if startxref == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(startxref[1])
+	if !strings.HasPrefix(doc[xref:], "xref\n0 7\n") {
+		t.Fatalf("startxref %d does not point at a table of 7 entries", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(doc[xref:], -1)
+	if len(entries) != 6 {
+		t.Fatalf("%d objects in the cross-reference table, want 6", len(entries))
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(entry[1])
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !strings.HasPrefix(doc[offset:], want) {
+			t.Errorf("object %d: offset %d points at %q", i+1, offset, doc[offset:min(len(doc), offset+10)])
+		}
+	}
+
+	stream := regexp.MustCompile(`(?s)<< /Length (\d+) >>\nstream\n(.*)endstream`).FindStringSubmatch(doc)
+	if stream == nil {
+		t.Fatal("no content stream")
+	}
+	if length, _ := strconv.Atoi(stream[1]); length != len(stream[2]) {
+		t.Errorf("stream /Length is %d, stream is %d bytes", length, len(stream[2]))
+	}
+
+	content := stream[2]
+	if strings.Count(content, " Tj ET\n") != 4 {
+		t.Errorf("content draws %d lines, want 4 without the blank one", strings.Count(content, " Tj ET\n"))
+	}
+	if !strings.Contains(content, `/F2 8 Tf`) {
+		t.Error("bold line is not set in Courier-Bold")
+	}
+	if !strings.Contains(content, `(Garlic bread \(vegan\)      1      4.50) Tj`) {
+		t.Error("parentheses are not escaped")
+	}
+	if !strings.Contains(content, `(C:\\till) Tj`) {
+		t.Error("backslash is not escaped")
+	}
+
+	// A centred line wider than the page starts at the left margin
+	// rather than before it
+	left := fmt.Sprintf("%.2f", (pdfPageWidth-PDFWidth*pdfCharWidth)/2)
+	rule := regexp.MustCompile(`Tf (-?[\d.]+) [\d.]+ Td \(=+\)`).FindStringSubmatch(content)
+	if rule == nil || rule[1] != left {
+		t.Errorf("overlong centred line is at %v, want the left margin %s", rule, left)
+	}
+}
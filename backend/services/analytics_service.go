@@ -0,0 +1,154 @@
+package services
+
+import (
+	"pizza-shop/config"
+	"pizza-shop/models"
+	"time"
+)
+
+// salesScope limits analytics queries to invoices in [$1, $2) that haven't
+// been wholly voided or refunded.
+const salesScope = `i.created_at >= $1 AND i.created_at < $2 AND i.status NOT IN ('voided', 'refunded')`
+
+// creditedLines joins what voids and refunds have taken off each invoice
+// line as cr.quantity and cr.amount, which are NULL for lines never credited.
+const creditedLines = `
+	LEFT JOIN (
+		SELECT invoice_item_id, SUM(quantity) AS quantity, SUM(amount) AS amount
+		FROM credit_note_items
+		GROUP BY invoice_item_id
+	) cr ON cr.invoice_item_id = ii.id`
+
+// GetSalesAnalytics aggregates sales between from and to by item, pizza
+// size, topping, hour of day and weekday. Whatever voids and refunds took
+// back is left out.
+func (s *ReportService) GetSalesAnalytics(from, to time.Time) (*models.SalesAnalytics, error) {
+	analytics := models.SalesAnalytics{
+		From:     from,
+		To:       to,
+		Items:    []models.ItemSales{},
+		Sizes:    []models.SizeSales{},
+		Toppings: []models.ToppingSales{},
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT ii.item_name,
+		       SUM(ii.quantity - COALESCE(cr.quantity, 0)),
+		       COUNT(DISTINCT i.id) FILTER (WHERE ii.quantity > COALESCE(cr.quantity, 0)),
+		       SUM(ii.subtotal - COALESCE(cr.amount, 0))
+		FROM invoice_items ii
+		JOIN invoices i ON i.id = ii.invoice_id`+creditedLines+`
+		WHERE `+salesScope+`
+		GROUP BY ii.item_name
+		HAVING SUM(ii.quantity - COALESCE(cr.quantity, 0)) > 0
+		ORDER BY 2 DESC, ii.item_name
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item models.ItemSales
+		if err := rows.Scan(&item.ItemName, &item.Quantity, &item.Orders, &item.Sales); err != nil {
+			return nil, err
+		}
+		analytics.Items = append(analytics.Items, item)
+	}
+	rows.Close()
+
+	rows, err = config.DB.Query(`
+		SELECT ii.size, SUM(ii.quantity - COALESCE(cr.quantity, 0)), SUM(ii.subtotal - COALESCE(cr.amount, 0))
+		FROM invoice_items ii
+		JOIN invoices i ON i.id = ii.invoice_id`+creditedLines+`
+		WHERE `+salesScope+` AND ii.size IS NOT NULL
+		GROUP BY ii.size
+		HAVING SUM(ii.quantity - COALESCE(cr.quantity, 0)) > 0
+		ORDER BY ii.size
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var size models.SizeSales
+		if err := rows.Scan(&size.Size, &size.Quantity, &size.Sales); err != nil {
+			return nil, err
+		}
+		analytics.Sizes = append(analytics.Sizes, size)
+	}
+	rows.Close()
+
+	rows, err = config.DB.Query(`
+		SELECT COALESCE(iit.name, t.name),
+		       SUM(iit.quantity * (ii.quantity - COALESCE(cr.quantity, 0))),
+		       SUM(ii.quantity - COALESCE(cr.quantity, 0)),
+		       SUM(iit.price * iit.quantity * (ii.quantity - COALESCE(cr.quantity, 0)))
+		FROM invoice_item_toppings iit
+		JOIN toppings t ON t.id = iit.topping_id
+		JOIN invoice_items ii ON ii.id = iit.invoice_item_id
+		JOIN invoices i ON i.id = ii.invoice_id`+creditedLines+`
+		WHERE `+salesScope+`
+		GROUP BY COALESCE(iit.name, t.name)
+		HAVING SUM(ii.quantity - COALESCE(cr.quantity, 0)) > 0
+		ORDER BY 2 DESC
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var topping models.ToppingSales
+		if err := rows.Scan(&topping.Name, &topping.Quantity, &topping.Pizzas, &topping.Sales); err != nil {
+			return nil, err
+		}
+		analytics.Toppings = append(analytics.Toppings, topping)
+	}
+	rows.Close()
+
+	analytics.Hours, err = salesByPeriod("HOUR", 24, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	analytics.Weekdays, err = salesByPeriod("DOW", 7, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return &analytics, nil
+}
+
+// salesByPeriod groups orders by a field of their creation time, net of
+// voids and refunds as in the Z report. Every period from 0 to count-1 is
+// returned, including those without sales.
+func salesByPeriod(field string, count int, from, to time.Time) ([]models.PeriodSales, error) {
+	periods := make([]models.PeriodSales, count)
+	for i := range periods {
+		periods[i].Period = i
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT EXTRACT(`+field+` FROM i.created_at)::int, COUNT(*),
+		       SUM(i.total_amount - COALESCE((SELECT SUM(amount) FROM credit_notes WHERE invoice_id = i.id), 0))
+		FROM invoices i
+		WHERE `+salesScope+`
+		GROUP BY 1
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var period models.PeriodSales
+		if err := rows.Scan(&period.Period, &period.Orders, &period.Sales); err != nil {
+			return nil, err
+		}
+		periods[period.Period] = period
+	}
+
+	return periods, nil
+}
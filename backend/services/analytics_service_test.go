@@ -0,0 +1,52 @@
+package services
+
+import (
+	"pizza-shop/models"
+	"testing"
+	"time"
+)
+
+// TestSalesAnalyticsNetsCredits voids one of two lines and checks the
+// analytics only count the line that was kept.
+func TestSalesAnalyticsNetsCredits(t *testing.T) {
+	db := useTestDB(t)
+	order := createTestOrder(t, db, 2, 1) // Two lines of 13.50
+
+	// Put the order on its own at a time no other order has
+	created := time.Date(2001, 2, 3, 4, 5, 0, 0, time.UTC) // A Saturday
+	testExec(t, db, `UPDATE invoices SET created_at = $1 WHERE id = $2`, created, order.invoiceID)
+
+	service := &InvoiceService{}
+	_, err := service.VoidInvoice(order.invoiceID, models.CreateCreditNoteInput{
+		ReasonCode: "customer_cancelled",
+		ApprovedBy: "manager",
+		Items:      []models.CreateCreditNoteItemInput{{InvoiceItemID: order.lineIDs[0], Quantity: 1}},
+	}, models.SystemActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	analytics, err := (&ReportService{}).GetSalesAnalytics(created, created.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(analytics.Items) != 1 {
+		t.Fatalf("got %d items, want 1", len(analytics.Items))
+	}
+	if item := analytics.Items[0]; item.Quantity != 1 || item.Orders != 1 || item.Sales != 1350 {
+		t.Errorf("item: %d sold on %d orders for %s, want 1 on 1 for 13.50", item.Quantity, item.Orders, item.Sales)
+	}
+	if len(analytics.Sizes) != 1 || analytics.Sizes[0].Quantity != 1 || analytics.Sizes[0].Sales != 1350 {
+		t.Errorf("sizes = %+v, want 1 large for 13.50", analytics.Sizes)
+	}
+	if len(analytics.Toppings) != 1 || analytics.Toppings[0].Quantity != 1 || analytics.Toppings[0].Sales != 150 {
+		t.Errorf("toppings = %+v, want 1 portion for 1.50", analytics.Toppings)
+	}
+	if hour := analytics.Hours[4]; hour.Orders != 1 || hour.Sales != 1350 {
+		t.Errorf("4am: %d orders for %s, want 1 for 13.50", hour.Orders, hour.Sales)
+	}
+	if day := analytics.Weekdays[6]; day.Orders != 1 || day.Sales != 1350 {
+		t.Errorf("Saturday: %d orders for %s, want 1 for 13.50", day.Orders, day.Sales)
+	}
+}
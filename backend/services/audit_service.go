@@ -0,0 +1,132 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"pizza-shop/config"
+	"pizza-shop/models"
+	"strconv"
+	"strings"
+)
+
+type AuditService struct{}
+
+// recordAudit appends an entry to the audit log. It runs in the caller's
+// transaction so the entry is kept exactly when the change is. before and
+// after are stored as JSON; nil stores null.
+func recordAudit(q querier, actor models.Actor, action, entityType string, entityID int, before, after interface{}) error {
+	beforeJSON, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(`
+		INSERT INTO audit_log (actor_id, actor_name, action, entity_type, entity_id, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, actor.StaffID, actor.Name, action, entityType, entityID, beforeJSON, afterJSON)
+	return err
+}
+
+func auditJSON(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
+
+// GetAuditLog returns one page of audit entries matching the filter, newest
+// first.
+func (s *AuditService) GetAuditLog(filter models.AuditFilter) (*models.AuditPage, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", fmt.Sprintf("$%d", len(args))))
+	}
+
+	if filter.ActorID != nil {
+		where("actor_id = ?", *filter.ActorID)
+	}
+	if filter.Action != "" {
+		where("action = ?", filter.Action)
+	}
+	if filter.EntityType != "" {
+		where("entity_type = ?", filter.EntityType)
+	}
+	if filter.EntityID != nil {
+		where("entity_id = ?", *filter.EntityID)
+	}
+	if filter.From != nil {
+		where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		where("created_at < ?", *filter.To)
+	}
+	if filter.Cursor != "" {
+		before, err := strconv.ParseInt(filter.Cursor, 10, 64)
+		if err != nil {
+			verr := &ValidationError{}
+			verr.Add("cursor", "is not valid")
+			return nil, verr
+		}
+		where("id < ?", before)
+	}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Fetch one extra row to know whether there is another page
+	args = append(args, filter.Limit+1)
+	rows, err := config.DB.Query(fmt.Sprintf(`
+		SELECT id, actor_id, actor_name, action, entity_type, entity_id, before, after, created_at
+		FROM audit_log
+		%s
+		ORDER BY id DESC
+		LIMIT $%d
+	`, whereClause, len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	page := models.AuditPage{Data: []models.AuditEntry{}, Limit: filter.Limit}
+	for rows.Next() {
+		var (
+			entry         models.AuditEntry
+			before, after []byte
+		)
+		err := rows.Scan(
+			&entry.ID,
+			&entry.ActorID,
+			&entry.ActorName,
+			&entry.Action,
+			&entry.EntityType,
+			&entry.EntityID,
+			&before,
+			&after,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entry.Before = before
+		entry.After = after
+		page.Data = append(page.Data, entry)
+	}
+
+	if len(page.Data) > filter.Limit {
+		page.Data = page.Data[:filter.Limit]
+		cursor := strconv.FormatInt(page.Data[len(page.Data)-1].ID, 10)
+		page.NextCursor = &cursor
+	}
+
+	return &page, nil
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"database/sql"
+	"pizza-shop/config"
+	"pizza-shop/models"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type CashDrawerService struct{}
+
+const cashDrawerColumns = `d.id, d.till_session_id, ts.terminal_id, t.name, ts.staff_id, s.name, d.status,
+	d.opening_float, d.opened_at, d.closed_at, COALESCE(d.closed_by, ''),
+	d.cash_sales, d.cash_refunds, d.pay_ins, d.pay_outs, d.expected_amount, d.counted_amount, d.over_short`
+
+const cashDrawerTables = `cash_drawers d
+	JOIN till_sessions ts ON ts.id = d.till_session_id
+	JOIN terminals t ON t.id = ts.terminal_id
+	JOIN staff s ON s.id = ts.staff_id`
+
+func scanCashDrawer(row interface{ Scan(...interface{}) error }, drawer *models.CashDrawer) error {
+	return row.Scan(
+		&drawer.ID,
+		&drawer.TillSessionID,
+		&drawer.TerminalID,
+		&drawer.TerminalName,
+		&drawer.StaffID,
+		&drawer.StaffName,
+		&drawer.Status,
+		&drawer.OpeningFloat,
+		&drawer.OpenedAt,
+		&drawer.ClosedAt,
+		&drawer.ClosedBy,
+		&drawer.CashSales,
+		&drawer.CashRefunds,
+		&drawer.PayIns,
+		&drawer.PayOuts,
+		&drawer.Expected,
+		&drawer.Counted,
+		&drawer.OverShort,
+	)
+}
+
+// loadCashDrawers loads the drawers matching where, newest first. Closed
+// drawers carry the totals stored when they were counted.
+func loadCashDrawers(db querier, where string, args ...interface{}) ([]models.CashDrawer, error) {
+	rows, err := db.Query(`
+		SELECT `+cashDrawerColumns+`
+		FROM `+cashDrawerTables+`
+		WHERE `+where+`
+		ORDER BY d.opened_at DESC, d.id DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drawers := []models.CashDrawer{}
+	for rows.Next() {
+		var drawer models.CashDrawer
+		if err := scanCashDrawer(rows, &drawer); err != nil {
+			return nil, err
+		}
+		drawers = append(drawers, drawer)
+	}
+
+	return drawers, nil
+}
+
+func getCashDrawer(db querier, id int) (*models.CashDrawer, error) {
+	var drawer models.CashDrawer
+	err := scanCashDrawer(db.QueryRow(`SELECT `+cashDrawerColumns+` FROM `+cashDrawerTables+` WHERE d.id = $1`, id), &drawer)
+	if err != nil {
+		return nil, err
+	}
+	return &drawer, nil
+}
+
+// cashDrawerTotals works out what an open drawer should hold from the cash
+// payments taken and cash refunds paid out in its till session and its
+// pay-ins and pay-outs.
+func cashDrawerTotals(db querier, drawer *models.CashDrawer) error {
+	var cashSales, cashRefunds, payIns, payOuts models.Money
+	err := db.QueryRow(`
+		SELECT COALESCE((SELECT SUM(amount) FROM payments
+		                 WHERE till_session_id = $2 AND method = 'cash'), 0),
+		       COALESCE((SELECT SUM(refund_amount) FROM credit_notes
+		                 WHERE till_session_id = $2 AND refund_method = 'cash'), 0),
+		       COALESCE((SELECT SUM(amount) FROM cash_movements WHERE drawer_id = $1 AND kind = 'pay_in'), 0),
+		       COALESCE((SELECT SUM(amount) FROM cash_movements WHERE drawer_id = $1 AND kind = 'pay_out'), 0)
+	`, drawer.ID, drawer.TillSessionID).Scan(&cashSales, &cashRefunds, &payIns, &payOuts)
+	if err != nil {
+		return err
+	}
+
+	expected := drawer.OpeningFloat + cashSales - cashRefunds + payIns - payOuts
+	drawer.CashSales = &cashSales
+	drawer.CashRefunds = &cashRefunds
+	drawer.PayIns = &payIns
+	drawer.PayOuts = &payOuts
+	drawer.Expected = &expected
+	return nil
+}
+
+func getCashMovements(db querier, drawerID int) ([]models.CashMovement, error) {
+	rows, err := db.Query(`
+		SELECT m.id, m.drawer_id, m.kind, m.amount, m.reason, m.staff_id, s.name, m.created_at
+		FROM cash_movements m
+		JOIN staff s ON s.id = m.staff_id
+		WHERE m.drawer_id = $1
+		ORDER BY m.id
+	`, drawerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var movements []models.CashMovement
+	for rows.Next() {
+		var movement models.CashMovement
+		err := rows.Scan(
+			&movement.ID,
+			&movement.DrawerID,
+			&movement.Kind,
+			&movement.Amount,
+			&movement.Reason,
+			&movement.StaffID,
+			&movement.StaffName,
+			&movement.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		movements = append(movements, movement)
+	}
+
+	return movements, nil
+}
+
+// lockOpenCashDrawer returns the open drawer of a till session and locks it
+// until tx ends.
+func lockOpenCashDrawer(tx *sql.Tx, tillSessionID int) (int, error) {
+	var id int
+	err := tx.QueryRow(`
+		SELECT id FROM cash_drawers
+		WHERE till_session_id = $1 AND status = 'open'
+		FOR UPDATE
+	`, tillSessionID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, &ConflictError{Message: "open the cash drawer before handling cash"}
+	}
+	return id, err
+}
+
+// GetCashDrawers lists the drawers opened in a date range, newest first.
+// status "" matches any.
+func (s *CashDrawerService) GetCashDrawers(status string, from, to *time.Time) ([]models.CashDrawer, error) {
+	drawers, err := loadCashDrawers(config.DB, "($1 = '' OR d.status = $1) AND "+
+		"($2::timestamp IS NULL OR d.opened_at >= $2) AND ($3::timestamp IS NULL OR d.opened_at < $3)", status, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range drawers {
+		if drawers[i].Status == models.CashDrawerOpen {
+			if err := cashDrawerTotals(config.DB, &drawers[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return drawers, nil
+}
+
+// GetCashDrawer returns a drawer with its movements. For blind, the totals
+// of an open drawer are left out so the cashier counts without knowing what
+// to expect.
+func (s *CashDrawerService) GetCashDrawer(id int, blind bool) (*models.CashDrawer, error) {
+	drawer, err := getCashDrawer(config.DB, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if drawer.Status == models.CashDrawerOpen && !blind {
+		if err := cashDrawerTotals(config.DB, drawer); err != nil {
+			return nil, err
+		}
+	}
+
+	drawer.Movements, err = getCashMovements(config.DB, id)
+	if err != nil {
+		return nil, err
+	}
+	return drawer, nil
+}
+
+// GetTillSessionDrawerID returns the drawer opened for a till session.
+func (s *CashDrawerService) GetTillSessionDrawerID(tillSessionID int) (int, error) {
+	var id int
+	err := config.DB.QueryRow(`SELECT id FROM cash_drawers WHERE till_session_id = $1`, tillSessionID).Scan(&id)
+	return id, err
+}
+
+// OpenCashDrawer starts counting cash for a till session with the float
+// put in the drawer. Each till session has one drawer.
+func (s *CashDrawerService) OpenCashDrawer(tillSessionID int, input models.OpenCashDrawerInput) (*models.CashDrawer, error) {
+	if input.OpeningFloat < 0 {
+		verr := &ValidationError{}
+		verr.Add("opening_float", "must not be negative")
+		return nil, verr
+	}
+
+	var id int
+	err := config.DB.QueryRow(`
+		INSERT INTO cash_drawers (till_session_id, opening_float)
+		VALUES ($1, $2)
+		RETURNING id
+	`, tillSessionID, input.OpeningFloat).Scan(&id)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, &ConflictError{Message: "a cash drawer has already been opened for this till session"}
+		}
+		return nil, err
+	}
+
+	return s.GetCashDrawer(id, true)
+}
+
+// AddCashMovement records a pay-in or pay-out. A pay-out can't take more
+// cash than the drawer should hold.
+func (s *CashDrawerService) AddCashMovement(drawerID int, input models.CreateCashMovementInput, staffID int) (*models.CashMovement, error) {
+	verr := &ValidationError{}
+	if input.Kind != models.CashPayIn && input.Kind != models.CashPayOut {
+		verr.Add("kind", "must be pay_in or pay_out")
+	}
+	if input.Amount <= 0 {
+		verr.Add("amount", "must be greater than zero")
+	}
+	if input.Reason == "" {
+		verr.Add("reason", "must not be empty")
+	}
+	if verr.HasProblems() {
+		return nil, verr
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	drawer, err := lockCashDrawer(tx, drawerID)
+	if err != nil {
+		return nil, err
+	}
+	if input.Kind == models.CashPayOut {
+		if err := cashDrawerTotals(tx, drawer); err != nil {
+			return nil, err
+		}
+		if input.Amount > *drawer.Expected {
+			return nil, &ConflictError{Message: "the drawer doesn't hold enough cash for this pay-out"}
+		}
+	}
+
+	movement := models.CashMovement{
+		DrawerID: drawerID,
+		Kind:     input.Kind,
+		Amount:   input.Amount,
+		Reason:   input.Reason,
+		StaffID:  staffID,
+	}
+	err = tx.QueryRow(`
+		WITH inserted AS (
+			INSERT INTO cash_movements (drawer_id, kind, amount, reason, staff_id)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at, staff_id
+		)
+		SELECT inserted.id, inserted.created_at, s.name
+		FROM inserted JOIN staff s ON s.id = inserted.staff_id
+	`, drawerID, input.Kind, input.Amount, input.Reason, staffID).Scan(&movement.ID, &movement.CreatedAt, &movement.StaffName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &movement, nil
+}
+
+// lockCashDrawer loads an open drawer and locks it until tx ends.
+func lockCashDrawer(tx *sql.Tx, drawerID int) (*models.CashDrawer, error) {
+	var drawer models.CashDrawer
+	err := scanCashDrawer(tx.QueryRow(`
+		SELECT `+cashDrawerColumns+`
+		FROM `+cashDrawerTables+`
+		WHERE d.id = $1
+		FOR UPDATE OF d
+	`, drawerID), &drawer)
+	if err != nil {
+		return nil, err
+	}
+	if drawer.Status != models.CashDrawerOpen {
+		return nil, &ConflictError{Message: "cash drawer is already closed"}
+	}
+	return &drawer, nil
+}
+
+// CloseCashDrawer records the counted cash and how far it was over or short
+// of what was expected. The totals are stored so later changes can't
+// rewrite a counted drawer.
+func (s *CashDrawerService) CloseCashDrawer(drawerID int, input models.CloseCashDrawerInput, closedBy string) (*models.CashDrawer, error) {
+	if *input.CountedAmount < 0 {
+		verr := &ValidationError{}
+		verr.Add("counted_amount", "must not be negative")
+		return nil, verr
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	drawer, err := lockCashDrawer(tx, drawerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := cashDrawerTotals(tx, drawer); err != nil {
+		return nil, err
+	}
+	overShort := *input.CountedAmount - *drawer.Expected
+
+	_, err = tx.Exec(`
+		UPDATE cash_drawers
+		SET status = 'closed', closed_at = LOCALTIMESTAMP, closed_by = $2,
+		    cash_sales = $3, cash_refunds = $4, pay_ins = $5, pay_outs = $6,
+		    expected_amount = $7, counted_amount = $8, over_short = $9
+		WHERE id = $1
+	`, drawerID, closedBy, *drawer.CashSales, *drawer.CashRefunds, *drawer.PayIns, *drawer.PayOuts,
+		*drawer.Expected, *input.CountedAmount, overShort)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetCashDrawer(drawerID, false)
+}
+
+// ensureCashDrawerClosed stops a till session being closed while its cash
+// is still to be counted.
+func ensureCashDrawerClosed(db querier, tillSessionID int) error {
+	var open bool
+	err := db.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM cash_drawers WHERE till_session_id = $1 AND status = 'open')
+	`, tillSessionID).Scan(&open)
+	if err != nil {
+		return err
+	}
+	if open {
+		return &ConflictError{Message: "count and close the cash drawer first"}
+	}
+	return nil
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"pizza-shop/config"
+	"pizza-shop/models"
+)
+
+// creditableItem is an invoice line with how much of it is still open to be
+// voided or refunded.
+type creditableItem struct {
+	ID        int
+	Category  string
+	Quantity  int
+	Subtotal  models.Money
+	Remaining int
+}
+
+func isReasonCode(code string) bool {
+	for _, known := range models.ReasonCodes {
+		if known == code {
+			return true
+		}
+	}
+	return false
+}
+
+// VoidInvoice cancels all or part of an order that hasn't been completed,
+// as long as what's left still covers what has been paid.
+func (s *InvoiceService) VoidInvoice(id int, input models.CreateCreditNoteInput, actor models.Actor) (*models.CreditNote, error) {
+	return s.createCreditNote(id, models.CreditNoteVoid, models.InvoiceStatusVoided, input, actor)
+}
+
+// RefundInvoice returns money for all or part of an order that has been
+// paid for, in full or in part, whether or not it has been completed.
+func (s *InvoiceService) RefundInvoice(id int, input models.CreateCreditNoteInput, actor models.Actor) (*models.CreditNote, error) {
+	return s.createCreditNote(id, models.CreditNoteRefund, models.InvoiceStatusRefunded, input, actor)
+}
+
+// createCreditNote reverses the requested quantities of an invoice. Once
+// every line is fully reversed the invoice moves to finalStatus.
+func (s *InvoiceService) createCreditNote(invoiceID int, kind, finalStatus string, input models.CreateCreditNoteInput, actor models.Actor) (*models.CreditNote, error) {
+	verr := &ValidationError{}
+	if !isReasonCode(input.ReasonCode) {
+		verr.Add("reason_code", "must be one of %v", models.ReasonCodes)
+	}
+	if input.ApprovedBy == "" {
+		verr.Add("approved_by", "a manager must approve every %s", kind)
+	}
+	if kind == models.CreditNoteRefund && !paymentMethods[input.RefundMethod] {
+		verr.Add("refund_method", "must be cash, card or voucher")
+	}
+	if kind == models.CreditNoteVoid && input.RefundMethod != "" {
+		verr.Add("refund_method", "nothing is paid back for a void")
+	}
+	if verr.HasProblems() {
+		return nil, verr
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Voids are only possible before completion and refunds until the
+	// order is closed, exactly when the lifecycle allows the matching final
+	// status
+	status, err := lockInvoiceStatus(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if !canTransition(status, finalStatus) {
+		return nil, &InvalidTransitionError{From: status, To: finalStatus}
+	}
+
+	var (
+		totalAmount, taxAmount      models.Money
+		creditedAmount, creditedTax models.Money
+		held                        models.Money
+	)
+	err = tx.QueryRow(`
+		SELECT i.total_amount, i.tax_amount,
+		       COALESCE(SUM(cn.amount), 0), COALESCE(SUM(cn.tax_amount), 0),
+		       (SELECT COALESCE(SUM(amount), 0) FROM payments WHERE invoice_id = i.id)
+		       - COALESCE(SUM(cn.refund_amount), 0)
+		FROM invoices i
+		LEFT JOIN credit_notes cn ON cn.invoice_id = i.id
+		WHERE i.id = $1
+		GROUP BY i.id
+	`, invoiceID).Scan(&totalAmount, &taxAmount, &creditedAmount, &creditedTax, &held)
+	if err != nil {
+		return nil, err
+	}
+
+	if kind == models.CreditNoteVoid {
+		// A void rewrites a sale, which a closed Z report has already counted
+		if err := ensurePeriodOpen(tx, invoiceID); err != nil {
+			return nil, err
+		}
+	}
+	if kind == models.CreditNoteRefund && held <= 0 {
+		return nil, &ConflictError{Message: "nothing has been paid that can be refunded; void it instead"}
+	}
+
+	items, err := getCreditableItems(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Work out how many of each line to reverse
+	quantities := make(map[int]int)
+	if len(input.Items) == 0 {
+		for _, item := range items {
+			quantities[item.ID] = item.Remaining
+		}
+	}
+	for i, line := range input.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		if line.Quantity <= 0 {
+			verr.Add(field+".quantity", "must be greater than zero")
+			continue
+		}
+		found := false
+		for _, item := range items {
+			if item.ID == line.InvoiceItemID {
+				found = true
+				quantities[item.ID] += line.Quantity
+				if quantities[item.ID] > item.Remaining {
+					verr.Add(field+".quantity", "only %d left to %s", item.Remaining, kind)
+				}
+			}
+		}
+		if !found {
+			verr.Add(field+".invoice_item_id", "item %d is not on invoice %d", line.InvoiceItemID, invoiceID)
+		}
+	}
+	if verr.HasProblems() {
+		return nil, verr
+	}
+
+	note := models.CreditNote{
+		InvoiceID:    invoiceID,
+		Kind:         kind,
+		ReasonCode:   input.ReasonCode,
+		Note:         input.Note,
+		ApprovedBy:   input.ApprovedBy,
+		RefundMethod: input.RefundMethod,
+	}
+	fullyCredited := true
+	var credited []taxableLine
+	for _, item := range items {
+		quantity := quantities[item.ID]
+		if quantity < item.Remaining {
+			fullyCredited = false
+		}
+		if quantity == 0 {
+			continue
+		}
+		amount := item.Subtotal.Share(int64(quantity), int64(item.Quantity))
+		note.Items = append(note.Items, models.CreditNoteItem{
+			InvoiceItemID: item.ID,
+			Quantity:      quantity,
+			Amount:        amount,
+		})
+		note.Amount += amount
+		credited = append(credited, taxableLine{Category: item.Category, Amount: amount})
+	}
+	if len(note.Items) == 0 {
+		verr.Add("items", "nothing left to %s on invoice %d", kind, invoiceID)
+		return nil, verr
+	}
+
+	if fullyCredited {
+		// The last credit note takes whatever is left so rounding on
+		// earlier partial credits can't leave stray cents behind
+		note.Amount = totalAmount - creditedAmount
+		note.TaxAmount = taxAmount - creditedTax
+	} else {
+		// Tax the credited lines the way the invoice taxed them, so a
+		// category's tax only comes back with lines of that category.
+		// Fixed charges are per invoice and come back with the last credit.
+		rules, err := invoicePercentageTaxes(tx, invoiceID)
+		if err != nil {
+			return nil, err
+		}
+		note.TaxAmount = exclusiveTax(applyTaxRules(rules, credited))
+		if left := taxAmount - creditedTax; note.TaxAmount > left {
+			note.TaxAmount = left
+		}
+	}
+
+	// Money that has been taken can only be given back by a refund, so a
+	// void mustn't leave less to pay than has been paid. A refund gives
+	// back what it credits, or what's still held on a part-paid order.
+	switch kind {
+	case models.CreditNoteVoid:
+		left := totalAmount + taxAmount - creditedAmount - creditedTax - note.Amount - note.TaxAmount
+		if left < held {
+			return nil, &ConflictError{Message: "invoice has payments recorded; refund it instead"}
+		}
+	case models.CreditNoteRefund:
+		note.RefundAmount = note.Amount + note.TaxAmount
+		if note.RefundAmount > held {
+			note.RefundAmount = held
+		}
+	}
+
+	// Cash is paid back out of the drawer of the manager's till, which
+	// stays locked until the refund is committed so it can't be counted in
+	// the meantime
+	if note.RefundMethod == models.PaymentCash {
+		if input.TillSessionID == nil {
+			return nil, &ConflictError{Message: "cash can only be refunded on a till with an open cash drawer"}
+		}
+		drawerID, err := lockOpenCashDrawer(tx, *input.TillSessionID)
+		if err != nil {
+			return nil, err
+		}
+		drawer, err := getCashDrawer(tx, drawerID)
+		if err != nil {
+			return nil, err
+		}
+		if err := cashDrawerTotals(tx, drawer); err != nil {
+			return nil, err
+		}
+		if note.RefundAmount > *drawer.Expected {
+			return nil, &ConflictError{Message: "the drawer doesn't hold enough cash for this refund"}
+		}
+		note.TillSessionID = input.TillSessionID
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO credit_notes (invoice_id, kind, reason_code, note, approved_by, amount, tax_amount,
+		                          refund_method, refund_amount, till_session_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), CASE WHEN $2 = 'refund' THEN $9::decimal END, $10)
+		RETURNING id, created_at
+	`, invoiceID, note.Kind, note.ReasonCode, note.Note, note.ApprovedBy,
+		note.Amount, note.TaxAmount, note.RefundMethod, note.RefundAmount, note.TillSessionID).Scan(&note.ID, &note.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range note.Items {
+		item := &note.Items[i]
+		item.CreditNoteID = note.ID
+		err = tx.QueryRow(`
+			INSERT INTO credit_note_items (credit_note_id, invoice_item_id, quantity, amount)
+			VALUES ($1, $2, $3, $4)
+			RETURNING id
+		`, note.ID, item.InvoiceItemID, item.Quantity, item.Amount).Scan(&item.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var pending pendingEvents
+	if kind == models.CreditNoteVoid {
+		if err := restockVoid(tx, note.ID, &pending); err != nil {
+			return nil, err
+		}
+	}
+
+	action := models.AuditInvoiceVoided
+	if kind == models.CreditNoteRefund {
+		action = models.AuditInvoiceRefunded
+	}
+	if err := recordAudit(tx, actor, action, models.AuditEntityInvoice, invoiceID, nil, note); err != nil {
+		return nil, err
+	}
+
+	if fullyCredited {
+		if err := changeStatus(tx, invoiceID, finalStatus, &pending, actor); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := pending.commit(tx); err != nil {
+		return nil, err
+	}
+
+	pending.publish()
+	if fullyCredited {
+		// Take the order off the kitchen screens
+		publishInvoiceTickets(invoiceID)
+	}
+
+	return &note, nil
+}
+
+func getCreditableItems(tx *sql.Tx, invoiceID int) ([]creditableItem, error) {
+	rows, err := tx.Query(`
+		SELECT ii.id, COALESCE(ii.category::text, ''), ii.quantity, ii.subtotal, ii.quantity - COALESCE(SUM(cni.quantity), 0)
+		FROM invoice_items ii
+		LEFT JOIN credit_note_items cni ON cni.invoice_item_id = ii.id
+		WHERE ii.invoice_id = $1
+		GROUP BY ii.id
+		ORDER BY ii.id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []creditableItem
+	for rows.Next() {
+		var item creditableItem
+		if err := rows.Scan(&item.ID, &item.Category, &item.Quantity, &item.Subtotal, &item.Remaining); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func getCreditNotes(invoiceID int) ([]models.CreditNote, error) {
+	rows, err := config.DB.Query(`
+		SELECT cn.id, cn.invoice_id, cn.kind, cn.reason_code, COALESCE(cn.note, ''), cn.approved_by,
+		       cn.amount, cn.tax_amount, cn.created_at, COALESCE(cn.refund_method, ''), COALESCE(cn.refund_amount, 0),
+		       cn.till_session_id,
+		       cni.id, cni.invoice_item_id, cni.quantity, cni.amount
+		FROM credit_notes cn
+		JOIN credit_note_items cni ON cni.credit_note_id = cn.id
+		WHERE cn.invoice_id = $1
+		ORDER BY cn.id, cni.id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []models.CreditNote
+	for rows.Next() {
+		var note models.CreditNote
+		var item models.CreditNoteItem
+		err := rows.Scan(
+			&note.ID,
+			&note.InvoiceID,
+			&note.Kind,
+			&note.ReasonCode,
+			&note.Note,
+			&note.ApprovedBy,
+			&note.Amount,
+			&note.TaxAmount,
+			&note.CreatedAt,
+			&note.RefundMethod,
+			&note.RefundAmount,
+			&note.TillSessionID,
+			&item.ID,
+			&item.InvoiceItemID,
+			&item.Quantity,
+			&item.Amount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		item.CreditNoteID = note.ID
+
+		if len(notes) == 0 || notes[len(notes)-1].ID != note.ID {
+			notes = append(notes, note)
+		}
+		last := &notes[len(notes)-1]
+		last.Items = append(last.Items, item)
+	}
+
+	return notes, nil
+}
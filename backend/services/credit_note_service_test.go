@@ -0,0 +1,244 @@
+package services
+
+import (
+	"errors"
+	"pizza-shop/models"
+	"testing"
+)
+
+// TestRefundPartPaidOrder cancels an order that was part paid before the
+// kitchen finished it: the refunds give back no more than was paid, and a
+// void can't cancel lines the customer has already paid for.
+func TestRefundPartPaidOrder(t *testing.T) {
+	db := useTestDB(t)
+	order := createTestOrder(t, db, 2, 3) // Two lines of 16.50 plus 10% tax, 36.30 due
+	service := &InvoiceService{}
+
+	payment := models.CreatePaymentInput{Tenders: []models.TenderInput{{Method: models.PaymentCard, Amount: 2000}}}
+	if _, err := service.RecordPayment(order.invoiceID, payment, models.SystemActor); err != nil {
+		t.Fatal(err)
+	}
+
+	credit := func(lineID int) models.CreateCreditNoteInput {
+		return models.CreateCreditNoteInput{
+			ReasonCode:   "customer_cancelled",
+			ApprovedBy:   "manager",
+			RefundMethod: models.PaymentCard,
+			Items:        []models.CreateCreditNoteItemInput{{InvoiceItemID: lineID, Quantity: 1}},
+		}
+	}
+	var conflict *ConflictError
+
+	void := models.CreateCreditNoteInput{ReasonCode: "customer_cancelled", ApprovedBy: "manager"}
+	if _, err := service.VoidInvoice(order.invoiceID, void, models.SystemActor); !errors.As(err, &conflict) {
+		t.Fatalf("voiding a paid order: got %v, want a conflict", err)
+	}
+
+	note, err := service.RefundInvoice(order.invoiceID, credit(order.lineIDs[0]), models.SystemActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.Amount != 1650 || note.TaxAmount != 165 || note.RefundAmount != 1815 {
+		t.Errorf("first refund credits %s + %s and pays back %s, want 16.50 + 1.65 and 18.15",
+			note.Amount, note.TaxAmount, note.RefundAmount)
+	}
+
+	invoice, err := service.GetInvoice(order.invoiceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invoice.Status != models.InvoiceStatusOpen || invoice.AmountDue != 1815 ||
+		invoice.AmountPaid != 185 || invoice.BalanceDue != 1630 {
+		t.Errorf("after one refund: %s, due %s, paid %s, balance %s; want open, 18.15, 1.85 and 16.30",
+			invoice.Status, invoice.AmountDue, invoice.AmountPaid, invoice.BalanceDue)
+	}
+
+	// The 1.85 still held has to go back to the customer
+	void.Items = credit(order.lineIDs[1]).Items
+	if _, err := service.VoidInvoice(order.invoiceID, void, models.SystemActor); !errors.As(err, &conflict) {
+		t.Fatalf("voiding the rest: got %v, want a conflict", err)
+	}
+
+	note, err = service.RefundInvoice(order.invoiceID, credit(order.lineIDs[1]), models.SystemActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.Amount != 1650 || note.TaxAmount != 165 || note.RefundAmount != 185 {
+		t.Errorf("last refund credits %s + %s and pays back %s, want 16.50 + 1.65 and 1.85",
+			note.Amount, note.TaxAmount, note.RefundAmount)
+	}
+
+	invoice, err = service.GetInvoice(order.invoiceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invoice.Status != models.InvoiceStatusRefunded || invoice.AmountDue != 0 ||
+		invoice.AmountPaid != 0 || invoice.BalanceDue != 0 {
+		t.Errorf("after both refunds: %s, due %s, paid %s, balance %s; want refunded and nothing owed",
+			invoice.Status, invoice.AmountDue, invoice.AmountPaid, invoice.BalanceDue)
+	}
+}
+
+func TestRefundNeedsMethod(t *testing.T) {
+	service := &InvoiceService{}
+	input := models.CreateCreditNoteInput{ReasonCode: "wrong_item", ApprovedBy: "manager"}
+
+	var verr *ValidationError
+	if _, err := service.RefundInvoice(1, input, models.SystemActor); !errors.As(err, &verr) {
+		t.Errorf("refund without a method: got %v, want a validation error", err)
+	}
+
+	input.RefundMethod = models.PaymentCash
+	if _, err := service.VoidInvoice(1, input, models.SystemActor); !errors.As(err, &verr) {
+		t.Errorf("void with a refund method: got %v, want a validation error", err)
+	}
+}
+
+// TestPartialCreditTax credits a drink from an order where only the pizza
+// was taxed, so no tax comes back with it.
+func TestPartialCreditTax(t *testing.T) {
+	db := useTestDB(t)
+	order := createTestOrder(t, db, 2, 0) // Two lines of 12.00
+
+	// Make the second line a drink and the tax pizza only
+	testExec(t, db, `UPDATE invoice_items SET category = 'pizza' WHERE id = $1`, order.lineIDs[0])
+	testExec(t, db, `UPDATE invoice_items SET category = 'beverage' WHERE id = $1`, order.lineIDs[1])
+	testExec(t, db, `
+		UPDATE invoice_taxes SET category = 'pizza', taxable_amount = 12.00, amount = 1.20 WHERE invoice_id = $1
+	`, order.invoiceID)
+	testExec(t, db, `UPDATE invoices SET tax_amount = 1.20 WHERE id = $1`, order.invoiceID)
+
+	service := &InvoiceService{}
+	void := func(lineID int) *models.CreditNote {
+		t.Helper()
+		note, err := service.VoidInvoice(order.invoiceID, models.CreateCreditNoteInput{
+			ReasonCode: "wrong_item",
+			ApprovedBy: "manager",
+			Items:      []models.CreateCreditNoteItemInput{{InvoiceItemID: lineID, Quantity: 1}},
+		}, models.SystemActor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return note
+	}
+
+	if note := void(order.lineIDs[1]); note.Amount != 1200 || note.TaxAmount != 0 {
+		t.Errorf("voiding the drink credits %s + %s, want 12.00 and no tax", note.Amount, note.TaxAmount)
+	}
+	if note := void(order.lineIDs[0]); note.Amount != 1200 || note.TaxAmount != 120 {
+		t.Errorf("voiding the pizza credits %s + %s, want 12.00 + 1.20", note.Amount, note.TaxAmount)
+	}
+}
+
+// TestVoidGivesBackLimitedSpecial voids part of an order that sold the last
+// of a limited special. The pizza was never handed over, so it goes back on
+// sale.
+func TestVoidGivesBackLimitedSpecial(t *testing.T) {
+	db := useTestDB(t)
+	order := createTestOrder(t, db, 2, 0)
+	testExec(t, db, `UPDATE items SET stock_count = 0, sold_out = true, is_available = false WHERE id = $1`, order.itemID)
+
+	service := &InvoiceService{}
+	_, err := service.VoidInvoice(order.invoiceID, models.CreateCreditNoteInput{
+		ReasonCode: "customer_cancelled",
+		ApprovedBy: "manager",
+		Items:      []models.CreateCreditNoteItemInput{{InvoiceItemID: order.lineIDs[0], Quantity: 1}},
+	}, models.SystemActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		stockCount           int
+		soldOut, isAvailable bool
+	)
+	err = db.QueryRow(`SELECT stock_count, sold_out, is_available FROM items WHERE id = $1`, order.itemID).
+		Scan(&stockCount, &soldOut, &isAvailable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stockCount != 1 || soldOut || !isAvailable {
+		t.Errorf("after the void: %d left, sold out %v, available %v; want 1 back on sale", stockCount, soldOut, isAvailable)
+	}
+}
+
+// TestRefundKeepsLimitedSpecialSold refunds part of an order that sold the
+// last of a limited special. The pizza was eaten, so it stays sold out.
+func TestRefundKeepsLimitedSpecialSold(t *testing.T) {
+	db := useTestDB(t)
+	order := createTestOrder(t, db, 2, 0) // 26.40 with tax
+	testExec(t, db, `UPDATE items SET stock_count = 0, sold_out = true, is_available = false WHERE id = $1`, order.itemID)
+
+	service := &InvoiceService{}
+	payment := models.CreatePaymentInput{Tenders: []models.TenderInput{{Method: models.PaymentCard, Amount: 2640}}}
+	if _, err := service.RecordPayment(order.invoiceID, payment, models.SystemActor); err != nil {
+		t.Fatal(err)
+	}
+	_, err := service.RefundInvoice(order.invoiceID, models.CreateCreditNoteInput{
+		ReasonCode:   "quality_issue",
+		ApprovedBy:   "manager",
+		RefundMethod: models.PaymentCard,
+		Items:        []models.CreateCreditNoteItemInput{{InvoiceItemID: order.lineIDs[0], Quantity: 1}},
+	}, models.SystemActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		stockCount           int
+		soldOut, isAvailable bool
+	)
+	err = db.QueryRow(`SELECT stock_count, sold_out, is_available FROM items WHERE id = $1`, order.itemID).
+		Scan(&stockCount, &soldOut, &isAvailable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stockCount != 0 || !soldOut || isAvailable {
+		t.Errorf("after the refund: %d left, sold out %v, available %v; want none and still sold out", stockCount, soldOut, isAvailable)
+	}
+}
+
+// TestVoidRestocksIngredients voids a line and checks the dough it would
+// have used goes back into stock.
+func TestVoidRestocksIngredients(t *testing.T) {
+	db := useTestDB(t)
+	order := createTestOrder(t, db, 2, 1)
+
+	doughID := testInsert(t, db, `
+		INSERT INTO ingredients (name, unit, on_hand) VALUES ('Test dough ' || $1, 'kg', 10) RETURNING id
+	`, order.itemID)
+	t.Cleanup(func() {
+		testExec(t, db, `DELETE FROM item_recipes WHERE ingredient_id = $1`, doughID)
+		testExec(t, db, `DELETE FROM topping_recipes WHERE ingredient_id = $1`, doughID)
+		testExec(t, db, `DELETE FROM ingredients WHERE id = $1`, doughID)
+	})
+	testExec(t, db, `INSERT INTO item_recipes (item_id, size, ingredient_id, quantity) VALUES ($1, 'large', $2, 0.4)`,
+		order.itemID, doughID)
+	testExec(t, db, `INSERT INTO item_recipes (item_id, size, ingredient_id, quantity) VALUES ($1, 'small', $2, 0.2)`,
+		order.itemID, doughID)
+	testExec(t, db, `INSERT INTO topping_recipes (topping_id, ingredient_id, quantity) VALUES ($1, $2, 0.05)`,
+		order.toppingIDs[0], doughID)
+
+	service := &InvoiceService{}
+	_, err := service.VoidInvoice(order.invoiceID, models.CreateCreditNoteInput{
+		ReasonCode: "customer_cancelled",
+		ApprovedBy: "manager",
+		Items:      []models.CreateCreditNoteItemInput{{InvoiceItemID: order.lineIDs[0], Quantity: 1}},
+	}, models.SystemActor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var onHand models.Quantity
+	if err := db.QueryRow(`SELECT on_hand FROM ingredients WHERE id = $1`, doughID).Scan(&onHand); err != nil {
+		t.Fatal(err)
+	}
+	// 10 kg plus a large base and one topping portion
+	want, err := models.ParseQuantity("10.45")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if onHand != want {
+		t.Errorf("on hand = %s, want %s", onHand, want)
+	}
+}
@@ -0,0 +1,13 @@
+package services
+
+import (
+	"database/sql"
+)
+
+// querier is satisfied by both *sql.DB and *sql.Tx, for helpers that run
+// either inside or outside a transaction.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"os"
+	"pizza-shop/config"
+	"pizza-shop/models"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+// Tests and benchmarks that need Postgres run against the database in
+// TEST_DATABASE_URL, which must have the schema from the README, and are
+// skipped when it isn't set. Each test removes the rows it creates.
+const testDatabaseEnv = "TEST_DATABASE_URL"
+
+// useTestDB points config.DB at the test database for the rest of tb.
+func useTestDB(tb testing.TB) *sql.DB {
+	tb.Helper()
+	dsn := os.Getenv(testDatabaseEnv)
+	if dsn == "" {
+		tb.Skip(testDatabaseEnv + " is not set")
+	}
+
+	connector, err := pq.NewConnector(dsn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	db := sql.OpenDB(countingConnector{connector})
+	if err := db.Ping(); err != nil {
+		db.Close()
+		tb.Fatal(err)
+	}
+
+	previous := config.DB
+	config.DB = db
+	tb.Cleanup(func() {
+		config.DB = previous
+		db.Close()
+	})
+	return db
+}
+
+// testQueries counts the statements sent to the test database, so tests
+// can check how many round trips an operation makes.
+var testQueries atomic.Int64
+
+// countingConnector counts every statement run on its connections. The
+// connections only offer Prepare, so database/sql prepares every query and
+// exec and none slip past the count.
+type countingConnector struct {
+	driver.Connector
+}
+
+func (c countingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{conn}, nil
+}
+
+type countingConn struct {
+	driver.Conn
+}
+
+func (c countingConn) Prepare(query string) (driver.Stmt, error) {
+	testQueries.Add(1)
+	return c.Conn.Prepare(query)
+}
+
+// testExec runs a statement the test setup depends on.
+func testExec(tb testing.TB, db *sql.DB, query string, args ...interface{}) {
+	tb.Helper()
+	if _, err := db.Exec(query, args...); err != nil {
+		tb.Fatalf("%s: %v", query, err)
+	}
+}
+
+// testInsert runs an INSERT ... RETURNING id and returns the id.
+func testInsert(tb testing.TB, db *sql.DB, query string, args ...interface{}) int {
+	tb.Helper()
+	var id int
+	if err := db.QueryRow(query, args...).Scan(&id); err != nil {
+		tb.Fatalf("%s: %v", query, err)
+	}
+	return id
+}
+
+// testOrder is an invoice written straight to the database, bypassing
+// pricing, so reads can be tested in isolation.
+type testOrder struct {
+	invoiceID  int
+	itemID     int
+	toppingIDs []int
+	lineIDs    []int
+}
+
+// createTestOrder writes an invoice with the given number of lines, each
+// a large pizza at 12.00 with one of every topping at 1.50, plus a 10%
+// tax. Everything is deleted again when tb finishes, even if setup fails
+// part way through.
+func createTestOrder(tb testing.TB, db *sql.DB, lines, toppings int) *testOrder {
+	tb.Helper()
+	order := &testOrder{}
+	tb.Cleanup(func() {
+		for _, query := range []string{
+			`DELETE FROM credit_note_items WHERE credit_note_id IN (SELECT id FROM credit_notes WHERE invoice_id = $1)`,
+			`DELETE FROM credit_notes WHERE invoice_id = $1`,
+			`DELETE FROM payments WHERE invoice_id = $1`,
+			`DELETE FROM invoice_item_toppings WHERE invoice_item_id IN (SELECT id FROM invoice_items WHERE invoice_id = $1)`,
+			`DELETE FROM invoice_items WHERE invoice_id = $1`,
+			`DELETE FROM invoice_taxes WHERE invoice_id = $1`,
+			`DELETE FROM invoice_status_history WHERE invoice_id = $1`,
+			`DELETE FROM invoices WHERE id = $1`,
+		} {
+			if _, err := db.Exec(query, order.invoiceID); err != nil {
+				tb.Errorf("%s: %v", query, err)
+			}
+		}
+		if _, err := db.Exec(`DELETE FROM toppings WHERE id = ANY($1)`, pq.Array(order.toppingIDs)); err != nil {
+			tb.Error(err)
+		}
+		if _, err := db.Exec(`DELETE FROM items WHERE id = $1`, order.itemID); err != nil {
+			tb.Error(err)
+		}
+	})
+
+	order.itemID = testInsert(tb, db, `
+		INSERT INTO items (name, category, price) VALUES ('Test Margherita', 'pizza', 12.00) RETURNING id
+	`)
+	for i := 0; i < toppings; i++ {
+		order.toppingIDs = append(order.toppingIDs, testInsert(tb, db, `
+			INSERT INTO toppings (name, price) VALUES ('Test topping', 1.50) RETURNING id
+		`))
+	}
+
+	lineAmount := models.Money(1200 + 150*toppings)
+	total := lineAmount.Mul(lines)
+	tax := total / 10
+	order.invoiceID = testInsert(tb, db, `
+		INSERT INTO invoices (order_no, total_amount, tax_amount, status)
+		VALUES ('TEST-' || nextval(pg_get_serial_sequence('invoices', 'id')), $1, $2, 'open')
+		RETURNING id
+	`, total, tax)
+	testExec(tb, db, `
+		INSERT INTO invoice_status_history (invoice_id, from_status, to_status) VALUES ($1, NULL, 'open')
+	`, order.invoiceID)
+	testExec(tb, db, `
+		INSERT INTO invoice_taxes (invoice_id, name, kind, rate, inclusive, taxable_amount, amount)
+		VALUES ($1, 'Test tax', 'percentage', 10, false, $2, $3)
+	`, order.invoiceID, total, tax)
+
+	for i := 0; i < lines; i++ {
+		lineID := testInsert(tb, db, `
+			INSERT INTO invoice_items (invoice_id, item_id, item_name, size, quantity, unit_price, subtotal)
+			VALUES ($1, $2, 'Test Margherita', 'large', 1, 12.00, $3)
+			RETURNING id
+		`, order.invoiceID, order.itemID, lineAmount)
+		order.lineIDs = append(order.lineIDs, lineID)
+		for _, toppingID := range order.toppingIDs {
+			testExec(tb, db, `
+				INSERT INTO invoice_item_toppings (invoice_item_id, topping_id, name, quantity, price)
+				VALUES ($1, $2, 'Test topping', 1, 1.50)
+			`, lineID, toppingID)
+		}
+	}
+
+	return order
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrOrderNoConflict is returned when an allocated order number is already
+// taken, e.g. after the counter was reset by hand. Controllers map it to
+// 409 Conflict.
+var ErrOrderNoConflict = errors.New("order number already in use")
+
+// ErrInvalidCredentials is returned when a login fails, without saying
+// whether the username or the password was wrong. Controllers map it to
+// 401 Unauthorized.
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// ErrTillSessionLocked is returned for a token whose till session has been
+// locked, closed or left idle. The cashier must log in with their PIN again.
+var ErrTillSessionLocked = errors.New("till session is locked; log in with your PIN")
+
+// ErrPINLockedOut is returned for PIN logins while a staff member is locked
+// out after too many wrong PINs. Controllers map it to 429 Too Many
+// Requests.
+var ErrPINLockedOut = errors.New("too many wrong PINs; try again later or log in with your password")
+
+// ErrPrintQueueFull is returned when a printer already has a full queue of
+// jobs waiting, usually because it is offline. Controllers map it to 503
+// Service Unavailable.
+var ErrPrintQueueFull = errors.New("print queue is full; check the printer is switched on")
+
+// ConflictError is returned when a request clashes with the current state
+// of a record, e.g. paying an invoice that is already paid. Controllers map
+// it to 409 Conflict.
+type ConflictError struct {
+	Message string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Message
+}
+
+// FieldError describes a single problem with a request payload.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned when a request is well-formed JSON but cannot
+// be processed, e.g. it references unknown or unavailable menu items.
+// Controllers map it to 422 Unprocessable Entity.
+type ValidationError struct {
+	Problems []FieldError
+}
+
+func (e *ValidationError) Add(field, format string, args ...interface{}) {
+	e.Problems = append(e.Problems, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (e *ValidationError) HasProblems() bool {
+	return len(e.Problems) > 0
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		messages[i] = p.Field + ": " + p.Message
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
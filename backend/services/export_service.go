@@ -0,0 +1,62 @@
+package services
+
+import (
+	"pizza-shop/config"
+	"pizza-shop/models"
+	"time"
+)
+
+// ExportInvoiceLines calls fn for every line of every invoice created in
+// [from, to), in invoice order. Rows are read from the database as they are
+// written, so exports of any size use constant memory.
+func (s *InvoiceService) ExportInvoiceLines(from, to *time.Time, fn func(models.InvoiceExportRow) error) error {
+	rows, err := config.DB.Query(`
+		SELECT i.id, i.order_no, i.created_at, i.status, i.total_amount, i.tax_amount,
+		       ii.id, ii.item_name, ii.size, ii.quantity, ii.unit_price,
+		       (SELECT SUM(iit.price * iit.quantity)
+		        FROM invoice_item_toppings iit
+		        WHERE iit.invoice_item_id = ii.id),
+		       ii.subtotal,
+		       COALESCE((SELECT string_agg(COALESCE(iit.name, t.name) || ' x' || iit.quantity || ' @ ' || iit.price, '; ' ORDER BY iit.id)
+		                 FROM invoice_item_toppings iit
+		                 JOIN toppings t ON t.id = iit.topping_id
+		                 WHERE iit.invoice_item_id = ii.id), '')
+		FROM invoices i
+		LEFT JOIN invoice_items ii ON ii.invoice_id = i.id
+		WHERE ($1::timestamp IS NULL OR i.created_at >= $1)
+		  AND ($2::timestamp IS NULL OR i.created_at < $2)
+		ORDER BY i.created_at, i.id, ii.id
+	`, from, to)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row models.InvoiceExportRow
+		err := rows.Scan(
+			&row.InvoiceID,
+			&row.OrderNo,
+			&row.CreatedAt,
+			&row.Status,
+			&row.TotalAmount,
+			&row.TaxAmount,
+			&row.LineID,
+			&row.ItemName,
+			&row.Size,
+			&row.Quantity,
+			&row.UnitPrice,
+			&row.ToppingsPrice,
+			&row.Subtotal,
+			&row.Toppings,
+		)
+		if err != nil {
+			return err
+		}
+		if err := fn(row); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,930 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"pizza-shop/config"
+	"pizza-shop/events"
+	"pizza-shop/models"
+	"sort"
+
+	"github.com/lib/pq"
+)
+
+type InventoryService struct{}
+
+const ingredientColumns = `id, name, unit, on_hand, low_stock_threshold, on_hand <= low_stock_threshold, created_at`
+
+func scanIngredient(row interface{ Scan(...interface{}) error }, ingredient *models.Ingredient) error {
+	return row.Scan(
+		&ingredient.ID,
+		&ingredient.Name,
+		&ingredient.Unit,
+		&ingredient.OnHand,
+		&ingredient.LowStockThreshold,
+		&ingredient.IsLowStock,
+		&ingredient.CreatedAt,
+	)
+}
+
+func validateIngredient(name, unit string, threshold models.Quantity) error {
+	verr := &ValidationError{}
+	if name == "" {
+		verr.Add("name", "must not be empty")
+	}
+	if unit == "" {
+		verr.Add("unit", "must not be empty")
+	}
+	if threshold < 0 {
+		verr.Add("low_stock_threshold", "must not be negative")
+	}
+	if verr.HasProblems() {
+		return verr
+	}
+	return nil
+}
+
+// GetIngredients lists ingredients by name, or only those at or below their
+// low-stock threshold.
+func (s *InventoryService) GetIngredients(lowStock bool) ([]models.Ingredient, error) {
+	rows, err := config.DB.Query(`
+		SELECT `+ingredientColumns+`
+		FROM ingredients
+		WHERE NOT $1 OR on_hand <= low_stock_threshold
+		ORDER BY name
+	`, lowStock)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ingredients := []models.Ingredient{}
+	for rows.Next() {
+		var ingredient models.Ingredient
+		if err := scanIngredient(rows, &ingredient); err != nil {
+			return nil, err
+		}
+		ingredients = append(ingredients, ingredient)
+	}
+
+	return ingredients, nil
+}
+
+func getIngredientForUpdate(tx *sql.Tx, id int) (*models.Ingredient, error) {
+	var ingredient models.Ingredient
+	err := scanIngredient(tx.QueryRow(`SELECT `+ingredientColumns+` FROM ingredients WHERE id = $1 FOR UPDATE`, id), &ingredient)
+	if err != nil {
+		return nil, err
+	}
+	return &ingredient, nil
+}
+
+func ingredientExists(err error, name string) error {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+		return &ConflictError{Message: "ingredient " + name + " already exists"}
+	}
+	return err
+}
+
+func (s *InventoryService) CreateIngredient(input models.CreateIngredientInput, actor models.Actor) (*models.Ingredient, error) {
+	if err := validateIngredient(input.Name, input.Unit, input.LowStockThreshold); err != nil {
+		return nil, err
+	}
+	if input.OnHand < 0 {
+		verr := &ValidationError{}
+		verr.Add("on_hand", "must not be negative")
+		return nil, verr
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var ingredient models.Ingredient
+	err = scanIngredient(tx.QueryRow(`
+		INSERT INTO ingredients (name, unit, on_hand, low_stock_threshold)
+		VALUES ($1, $2, $3, $4)
+		RETURNING `+ingredientColumns,
+		input.Name, input.Unit, input.OnHand, input.LowStockThreshold), &ingredient)
+	if err != nil {
+		return nil, ingredientExists(err, input.Name)
+	}
+
+	err = recordAudit(tx, actor, models.AuditIngredientCreated, models.AuditEntityIngredient, ingredient.ID, nil, ingredient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ingredient, tx.Commit()
+}
+
+func (s *InventoryService) UpdateIngredient(id int, input models.UpdateIngredientInput, actor models.Actor) (*models.Ingredient, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := getIngredientForUpdate(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ingredient := *before
+	if input.Name != nil {
+		ingredient.Name = *input.Name
+	}
+	if input.Unit != nil {
+		ingredient.Unit = *input.Unit
+	}
+	if input.LowStockThreshold != nil {
+		ingredient.LowStockThreshold = *input.LowStockThreshold
+	}
+	if err := validateIngredient(ingredient.Name, ingredient.Unit, ingredient.LowStockThreshold); err != nil {
+		return nil, err
+	}
+
+	err = scanIngredient(tx.QueryRow(`
+		UPDATE ingredients
+		SET name = $1, unit = $2, low_stock_threshold = $3
+		WHERE id = $4
+		RETURNING `+ingredientColumns,
+		ingredient.Name, ingredient.Unit, ingredient.LowStockThreshold, id), &ingredient)
+	if err != nil {
+		return nil, ingredientExists(err, ingredient.Name)
+	}
+
+	err = recordAudit(tx, actor, models.AuditIngredientUpdated, models.AuditEntityIngredient, id, before, ingredient)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ingredient, tx.Commit()
+}
+
+// AdjustStock records a delivery, waste or stock take for an ingredient.
+func (s *InventoryService) AdjustStock(id int, input models.AdjustStockInput, actor models.Actor) (*models.Ingredient, error) {
+	verr := &ValidationError{}
+	if (input.Change == nil) == (input.Count == nil) {
+		verr.Add("change", "either change or count is required")
+	} else if input.Change != nil && *input.Change == 0 {
+		verr.Add("change", "must not be zero")
+	} else if input.Count != nil && *input.Count < 0 {
+		verr.Add("count", "must not be negative")
+	}
+	if verr.HasProblems() {
+		return nil, verr
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	scope, err := lockStockScope(tx, stockScope{ingredients: []int{id}})
+	if err != nil {
+		return nil, err
+	}
+	before, err := getIngredientForUpdate(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	onHand := before.OnHand
+	if input.Change != nil {
+		onHand += *input.Change
+	} else {
+		onHand = *input.Count
+	}
+	if onHand < 0 {
+		verr.Add("change", "only %s %s is in stock", before.OnHand, before.Unit)
+		return nil, verr
+	}
+
+	var ingredient models.Ingredient
+	err = scanIngredient(tx.QueryRow(`
+		UPDATE ingredients SET on_hand = $1 WHERE id = $2
+		RETURNING `+ingredientColumns,
+		onHand, id), &ingredient)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordAudit(tx, actor, models.AuditStockAdjusted, models.AuditEntityIngredient, id,
+		map[string]models.Quantity{"on_hand": before.OnHand},
+		map[string]interface{}{"on_hand": ingredient.OnHand, "reason": input.Reason})
+	if err != nil {
+		return nil, err
+	}
+
+	var pending pendingEvents
+	if err := refreshStockAvailability(tx, scope, &pending); err != nil {
+		return nil, err
+	}
+	if err := pending.commit(tx); err != nil {
+		return nil, err
+	}
+
+	pending.publish()
+	return &ingredient, nil
+}
+
+// getRecipe loads the recipe lines selected by query, which takes the
+// item or topping id.
+func getRecipe(q querier, query string, id int) ([]models.RecipeLine, error) {
+	rows, err := q.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []models.RecipeLine{}
+	for rows.Next() {
+		var line models.RecipeLine
+		err := rows.Scan(&line.IngredientID, &line.IngredientName, &line.Unit, &line.Size, &line.Quantity)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+func getItemRecipe(q querier, itemID int) ([]models.RecipeLine, error) {
+	return getRecipe(q, `
+		SELECT r.ingredient_id, g.name, g.unit, r.size, r.quantity
+		FROM item_recipes r
+		JOIN ingredients g ON g.id = r.ingredient_id
+		WHERE r.item_id = $1
+		ORDER BY r.size NULLS FIRST, g.name
+	`, itemID)
+}
+
+func getToppingRecipe(q querier, toppingID int) ([]models.RecipeLine, error) {
+	return getRecipe(q, `
+		SELECT r.ingredient_id, g.name, g.unit, NULL, r.quantity
+		FROM topping_recipes r
+		JOIN ingredients g ON g.id = r.ingredient_id
+		WHERE r.topping_id = $1
+		ORDER BY g.name
+	`, toppingID)
+}
+
+func (s *InventoryService) GetItemRecipe(itemID int) ([]models.RecipeLine, error) {
+	var exists bool
+	if err := config.DB.QueryRow(`SELECT true FROM items WHERE id = $1`, itemID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	return getItemRecipe(config.DB, itemID)
+}
+
+func (s *InventoryService) GetToppingRecipe(toppingID int) ([]models.RecipeLine, error) {
+	var exists bool
+	if err := config.DB.QueryRow(`SELECT true FROM toppings WHERE id = $1`, toppingID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	return getToppingRecipe(config.DB, toppingID)
+}
+
+// validateRecipe checks the lines of a recipe. Sizes are only allowed when
+// sized is set, i.e. for pizzas.
+func validateRecipe(tx *sql.Tx, lines []models.RecipeLineInput, sized bool) error {
+	verr := &ValidationError{}
+	seen := make(map[string]bool)
+	for i, line := range lines {
+		field := fmt.Sprintf("lines[%d]", i)
+		if line.Quantity <= 0 {
+			verr.Add(field+".quantity", "must be greater than zero")
+		}
+		if line.Size != "" && !sized {
+			verr.Add(field+".size", "sizes only apply to pizzas")
+		} else if line.Size != "" && !pizzaSizes[line.Size] {
+			verr.Add(field+".size", "must be one of small, medium, large")
+		}
+
+		key := fmt.Sprintf("%d/%s", line.IngredientID, line.Size)
+		if seen[key] {
+			verr.Add(field+".ingredient_id", "ingredient %d is already in the recipe", line.IngredientID)
+		}
+		seen[key] = true
+
+		var exists bool
+		err := tx.QueryRow(`SELECT true FROM ingredients WHERE id = $1`, line.IngredientID).Scan(&exists)
+		if err == sql.ErrNoRows {
+			verr.Add(field+".ingredient_id", "ingredient %d does not exist", line.IngredientID)
+		} else if err != nil {
+			return err
+		}
+	}
+	if verr.HasProblems() {
+		return verr
+	}
+	return nil
+}
+
+// SetItemRecipe replaces the ingredients that go into one of an item.
+func (s *InventoryService) SetItemRecipe(itemID int, input models.SetRecipeInput, actor models.Actor) ([]models.RecipeLine, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	item, err := getItemForUpdate(tx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateRecipe(tx, input.Lines, item.Category == "pizza"); err != nil {
+		return nil, err
+	}
+
+	before, err := getItemRecipe(tx, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM item_recipes WHERE item_id = $1`, itemID); err != nil {
+		return nil, err
+	}
+	for _, line := range input.Lines {
+		var size *string
+		if line.Size != "" {
+			size = &line.Size
+		}
+		_, err := tx.Exec(`
+			INSERT INTO item_recipes (item_id, size, ingredient_id, quantity)
+			VALUES ($1, $2, $3, $4)
+		`, itemID, size, line.IngredientID, line.Quantity)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	after, err := getItemRecipe(tx, itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordAudit(tx, actor, models.AuditItemRecipeUpdated, models.AuditEntityItem, itemID, before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending pendingEvents
+	if err := refreshStockAvailability(tx, stockScope{items: []int{itemID}}, &pending); err != nil {
+		return nil, err
+	}
+	if err := pending.commit(tx); err != nil {
+		return nil, err
+	}
+
+	pending.publish()
+	return after, nil
+}
+
+// SetToppingRecipe replaces the ingredients that go into one portion of a
+// topping.
+func (s *InventoryService) SetToppingRecipe(toppingID int, input models.SetRecipeInput, actor models.Actor) ([]models.RecipeLine, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT true FROM toppings WHERE id = $1 FOR UPDATE`, toppingID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if err := validateRecipe(tx, input.Lines, false); err != nil {
+		return nil, err
+	}
+
+	before, err := getToppingRecipe(tx, toppingID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM topping_recipes WHERE topping_id = $1`, toppingID); err != nil {
+		return nil, err
+	}
+	for _, line := range input.Lines {
+		_, err := tx.Exec(`
+			INSERT INTO topping_recipes (topping_id, ingredient_id, quantity)
+			VALUES ($1, $2, $3)
+		`, toppingID, line.IngredientID, line.Quantity)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	after, err := getToppingRecipe(tx, toppingID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordAudit(tx, actor, models.AuditToppingRecipeUpdated, models.AuditEntityTopping, toppingID, before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending pendingEvents
+	if err := refreshStockAvailability(tx, stockScope{toppings: []int{toppingID}}, &pending); err != nil {
+		return nil, err
+	}
+	if err := pending.commit(tx); err != nil {
+		return nil, err
+	}
+
+	pending.publish()
+	return after, nil
+}
+
+// recipeLine is one ingredient in a recipe. size is only set for item
+// recipes that apply to one pizza size.
+type recipeLine struct {
+	size         *string
+	ingredientID int
+	quantity     models.Quantity
+}
+
+// stockUsage works out how much of each ingredient lines use, loading every
+// recipe they need at once. Topping recipes are per portion, so they are
+// used topping quantity times item quantity times.
+func stockUsage(tx *sql.Tx, lines []pricedItem) (map[int]models.Quantity, error) {
+	var itemIDs, toppingIDs []int
+	for _, line := range lines {
+		itemIDs = append(itemIDs, line.ItemID)
+		for _, topping := range line.Toppings {
+			toppingIDs = append(toppingIDs, topping.ToppingID)
+		}
+	}
+
+	itemRecipes := make(map[int][]recipeLine)
+	rows, err := tx.Query(`
+		SELECT item_id, size, ingredient_id, quantity FROM item_recipes WHERE item_id = ANY($1)
+	`, pq.Array(itemIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			itemID int
+			line   recipeLine
+		)
+		if err := rows.Scan(&itemID, &line.size, &line.ingredientID, &line.quantity); err != nil {
+			return nil, err
+		}
+		itemRecipes[itemID] = append(itemRecipes[itemID], line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	toppingRecipes := make(map[int][]recipeLine)
+	rows, err = tx.Query(`
+		SELECT topping_id, ingredient_id, quantity FROM topping_recipes WHERE topping_id = ANY($1)
+	`, pq.Array(toppingIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			toppingID int
+			line      recipeLine
+		)
+		if err := rows.Scan(&toppingID, &line.ingredientID, &line.quantity); err != nil {
+			return nil, err
+		}
+		toppingRecipes[toppingID] = append(toppingRecipes[toppingID], line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	usage := make(map[int]models.Quantity)
+	for _, line := range lines {
+		for _, recipe := range itemRecipes[line.ItemID] {
+			if recipe.size == nil || (line.Size != nil && *recipe.size == *line.Size) {
+				usage[recipe.ingredientID] += recipe.quantity.Mul(line.Quantity)
+			}
+		}
+		for _, topping := range line.Toppings {
+			for _, recipe := range toppingRecipes[topping.ToppingID] {
+				usage[recipe.ingredientID] += recipe.quantity.Mul(topping.Quantity * line.Quantity)
+			}
+		}
+	}
+	return usage, nil
+}
+
+// depleteStock takes what an order's lines use out of stock: one off the
+// count of each limited special, and the ingredients in their recipes.
+// Orders needing more than is left are refused with a ValidationError.
+// What the order used is then refreshed, adding an event to pending for
+// each item and topping that sold out.
+func depleteStock(tx *sql.Tx, lines []pricedItem, pending *pendingEvents) error {
+	verr := &ValidationError{}
+
+	counts := make(map[int]int)
+	names := make(map[int]string)
+	for _, line := range lines {
+		counts[line.ItemID] += line.Quantity
+		names[line.ItemID] = line.ItemName
+	}
+	usage, err := stockUsage(tx, lines)
+	if err != nil {
+		return err
+	}
+
+	scope, err := lockStockScope(tx, stockScope{items: sortedKeys(counts), ingredients: sortedKeys(usage)})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range sortedKeys(counts) {
+		var left *int
+		err := tx.QueryRow(`
+			UPDATE items SET stock_count = stock_count - $2
+			WHERE id = $1 AND stock_count IS NOT NULL
+			RETURNING stock_count
+		`, id, counts[id]).Scan(&left)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+		if left != nil && *left < 0 {
+			verr.Add("items", "only %d %s left", *left+counts[id], names[id])
+		}
+	}
+
+	for _, id := range sortedKeys(usage) {
+		var (
+			name   string
+			onHand models.Quantity
+		)
+		err := tx.QueryRow(`
+			UPDATE ingredients SET on_hand = on_hand - $2 WHERE id = $1
+			RETURNING name, on_hand
+		`, id, usage[id]).Scan(&name, &onHand)
+		if err != nil {
+			return err
+		}
+		if onHand < 0 {
+			verr.Add("items", "not enough %s in stock", name)
+		}
+	}
+
+	if verr.HasProblems() {
+		return verr
+	}
+	return refreshStockAvailability(tx, scope, pending)
+}
+
+// restockVoid puts back the limited specials and ingredients a void credit
+// note cancels, as the order is cancelled before it's handed over, so an
+// item that sold out can be sold again. Food the kitchen had already made
+// is recorded as waste with AdjustStock. Nothing comes back with a refund:
+// that food was eaten or thrown away.
+func restockVoid(tx *sql.Tx, creditNoteID int, pending *pendingEvents) error {
+	var (
+		lines   []pricedItem
+		lineIDs []int
+	)
+	rows, err := tx.Query(`
+		SELECT ii.id, ii.item_id, ii.size, cni.quantity
+		FROM credit_note_items cni
+		JOIN invoice_items ii ON ii.id = cni.invoice_item_id
+		WHERE cni.credit_note_id = $1 AND ii.item_id IS NOT NULL
+		ORDER BY ii.id
+	`, creditNoteID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			lineID int
+			line   pricedItem
+		)
+		if err := rows.Scan(&lineID, &line.ItemID, &line.Size, &line.Quantity); err != nil {
+			return err
+		}
+		lineIDs = append(lineIDs, lineID)
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	rows, err = tx.Query(`
+		SELECT invoice_item_id, topping_id, quantity FROM invoice_item_toppings
+		WHERE invoice_item_id = ANY($1) AND topping_id IS NOT NULL
+		ORDER BY id
+	`, pq.Array(lineIDs))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			lineID  int
+			topping pricedTopping
+		)
+		if err := rows.Scan(&lineID, &topping.ToppingID, &topping.Quantity); err != nil {
+			return err
+		}
+		for i := range lines {
+			if lineIDs[i] == lineID {
+				lines[i].Toppings = append(lines[i].Toppings, topping)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	usage, err := stockUsage(tx, lines)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[int]int)
+	for _, line := range lines {
+		counts[line.ItemID] += line.Quantity
+	}
+
+	scope, err := lockStockScope(tx, stockScope{items: sortedKeys(counts), ingredients: sortedKeys(usage)})
+	if err != nil {
+		return err
+	}
+	for _, id := range sortedKeys(counts) {
+		_, err := tx.Exec(`
+			UPDATE items SET stock_count = stock_count + $2
+			WHERE id = $1 AND stock_count IS NOT NULL
+		`, id, counts[id])
+		if err != nil {
+			return err
+		}
+	}
+	for _, id := range sortedKeys(usage) {
+		if _, err := tx.Exec(`UPDATE ingredients SET on_hand = on_hand + $2 WHERE id = $1`, id, usage[id]); err != nil {
+			return err
+		}
+	}
+
+	return refreshStockAvailability(tx, scope, pending)
+}
+
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}
+
+// itemStockNeeds is a CTE of how much of each ingredient one of each item
+// needs, at each pizza size on the menu. size is NULL for other items.
+const itemStockNeeds = `item_needs AS (
+		SELECT i.id, i.name, p.size, r.ingredient_id, SUM(r.quantity) AS quantity
+		FROM item_recipes r
+		JOIN items i ON i.id = r.item_id
+		LEFT JOIN pizza_base_prices p ON i.category = 'pizza' AND p.item_id = i.id
+		     AND (r.size IS NULL OR r.size = p.size)
+		WHERE i.category <> 'pizza' OR p.size IS NOT NULL
+		GROUP BY i.id, i.name, p.size, r.ingredient_id
+	)`
+
+// stockScope is the part of the menu a stock change can affect: the items
+// and toppings it changed and the ingredients whose stock it changed.
+type stockScope struct {
+	items       []int
+	toppings    []int
+	ingredients []int
+}
+
+// lockStockScope widens scope to the items and toppings made with its
+// ingredients and locks them, items then toppings, each in id order. Stock
+// changes lock what they affect this way before updating ingredients, which
+// are updated in id order too, so changes made at the same time can't
+// deadlock. Rows are locked FOR NO KEY UPDATE, which doesn't wait on the
+// key share locks orders take on the items and toppings their lines
+// reference.
+func lockStockScope(tx *sql.Tx, scope stockScope) (stockScope, error) {
+	locked := stockScope{ingredients: scope.ingredients}
+	queries := []struct {
+		ids   *[]int
+		query string
+		given []int
+	}{
+		{&locked.items, `
+			SELECT id FROM items
+			WHERE id = ANY($1) OR id IN (SELECT item_id FROM item_recipes WHERE ingredient_id = ANY($2))
+			ORDER BY id
+			FOR NO KEY UPDATE
+		`, scope.items},
+		{&locked.toppings, `
+			SELECT id FROM toppings
+			WHERE id = ANY($1) OR id IN (SELECT topping_id FROM topping_recipes WHERE ingredient_id = ANY($2))
+			ORDER BY id
+			FOR NO KEY UPDATE
+		`, scope.toppings},
+	}
+
+	for _, q := range queries {
+		rows, err := tx.Query(q.query, pq.Array(q.given), pq.Array(scope.ingredients))
+		if err != nil {
+			return stockScope{}, err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return stockScope{}, err
+			}
+			*q.ids = append(*q.ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return stockScope{}, err
+		}
+	}
+
+	return locked, nil
+}
+
+// refreshStockAvailability marks the items and toppings in scope that can
+// no longer be made as sold out and unavailable, and makes those that were
+// sold out available again once they can be. A pizza is sold out when none
+// of its sizes can be made. scope must take in everything made with the
+// ingredients that changed, as lockStockScope returns it. It runs in the
+// transaction that changed the stock, adding an event to pending for each
+// item and topping that changed.
+func refreshStockAvailability(tx *sql.Tx, scope stockScope, pending *pendingEvents) error {
+	rows, err := tx.Query(`
+		WITH `+itemStockNeeds+`,
+		short AS (
+			SELECT DISTINCT n.id, n.size
+			FROM item_needs n
+			JOIN ingredients g ON g.id = n.ingredient_id
+			WHERE g.on_hand < n.quantity AND n.id = ANY($1)
+		),
+		unmakeable AS (
+			SELECT i.id FROM items i
+			WHERE i.id = ANY($1)
+			  AND (i.stock_count <= 0
+			       OR EXISTS (SELECT 1 FROM short s WHERE s.id = i.id AND s.size IS NULL)
+			       OR (i.category = 'pizza'
+			           AND EXISTS (SELECT 1 FROM short s WHERE s.id = i.id)
+			           AND NOT EXISTS (SELECT 1 FROM pizza_base_prices p
+			                           WHERE p.item_id = i.id
+			                             AND NOT EXISTS (SELECT 1 FROM short s WHERE s.id = i.id AND s.size = p.size))))
+		),
+		changed AS (
+			SELECT id FROM items
+			WHERE id = ANY($1)
+			  AND ((is_available AND NOT sold_out AND id IN (SELECT id FROM unmakeable))
+			       OR (sold_out AND id NOT IN (SELECT id FROM unmakeable)))
+			ORDER BY id
+			FOR NO KEY UPDATE
+		)
+		UPDATE items i
+		SET sold_out = NOT i.sold_out, is_available = i.sold_out
+		FROM changed c
+		WHERE i.id = c.id
+		RETURNING i.id, i.name, i.sold_out
+	`, pq.Array(scope.items))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			item    events.ItemStock
+			soldOut bool
+		)
+		if err := rows.Scan(&item.ItemID, &item.Name, &soldOut); err != nil {
+			return err
+		}
+		if soldOut {
+			pending.add(events.ItemOutOfStock, item)
+		} else {
+			pending.add(events.ItemRestocked, item)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	rows, err = tx.Query(`
+		WITH unmakeable AS (
+			SELECT r.topping_id AS id
+			FROM topping_recipes r
+			JOIN ingredients g ON g.id = r.ingredient_id
+			WHERE g.on_hand < r.quantity AND r.topping_id = ANY($1)
+		),
+		changed AS (
+			SELECT id FROM toppings
+			WHERE id = ANY($1)
+			  AND ((is_available AND NOT sold_out AND id IN (SELECT id FROM unmakeable))
+			       OR (sold_out AND id NOT IN (SELECT id FROM unmakeable)))
+			ORDER BY id
+			FOR NO KEY UPDATE
+		)
+		UPDATE toppings t
+		SET sold_out = NOT t.sold_out, is_available = t.sold_out
+		FROM changed c
+		WHERE t.id = c.id
+		RETURNING t.id, t.name, t.sold_out
+	`, pq.Array(scope.toppings))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			topping events.ToppingStock
+			soldOut bool
+		)
+		if err := rows.Scan(&topping.ToppingID, &topping.Name, &soldOut); err != nil {
+			return err
+		}
+		if soldOut {
+			pending.add(events.ToppingOutOfStock, topping)
+		} else {
+			pending.add(events.ToppingRestocked, topping)
+		}
+	}
+	return rows.Err()
+}
+
+// GetStockShortages lists the items, at each pizza size on the menu, and
+// the toppings that need more of an ingredient than is in stock.
+func (s *InventoryService) GetStockShortages() (*models.StockShortages, error) {
+	shortages := &models.StockShortages{}
+
+	var err error
+	shortages.Items, err = getStockShortages(`
+		WITH ` + itemStockNeeds + `
+		SELECT n.id, n.name, n.size, array_agg(g.name ORDER BY g.name)
+		FROM item_needs n
+		JOIN ingredients g ON g.id = n.ingredient_id
+		WHERE g.on_hand < n.quantity
+		GROUP BY n.id, n.name, n.size
+		ORDER BY n.name, n.id, n.size
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	shortages.Toppings, err = getStockShortages(`
+		SELECT t.id, t.name, NULL, array_agg(g.name ORDER BY g.name)
+		FROM topping_recipes r
+		JOIN toppings t ON t.id = r.topping_id
+		JOIN ingredients g ON g.id = r.ingredient_id
+		WHERE g.on_hand < r.quantity
+		GROUP BY t.id, t.name
+		ORDER BY t.name, t.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	return shortages, nil
+}
+
+func getStockShortages(query string) ([]models.StockShortage, error) {
+	rows, err := config.DB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shortages := []models.StockShortage{}
+	for rows.Next() {
+		var shortage models.StockShortage
+		err := rows.Scan(&shortage.ID, &shortage.Name, &shortage.Size, pq.Array(&shortage.Ingredients))
+		if err != nil {
+			return nil, err
+		}
+		shortages = append(shortages, shortage)
+	}
+
+	return shortages, nil
+}
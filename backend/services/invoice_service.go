@@ -1,84 +1,339 @@
 package services
 
 import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
 	"pizza-shop/config"
+	"pizza-shop/events"
 	"pizza-shop/models"
 	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 type InvoiceService struct{}
 
-func (s *InvoiceService) CreateInvoice(input models.CreateInvoiceInput) (*models.Invoice, error) {
+var pizzaSizes = map[string]bool{"small": true, "medium": true, "large": true}
+
+type pricedTopping struct {
+	ToppingID int
+	Name      string
+	Quantity  int
+	Price     models.Money
+}
+
+type pricedItem struct {
+	ItemID    int
+	ItemName  string
+	Category  string
+	Size      *string
+	Quantity  int
+	UnitPrice models.Money
+	Toppings  []pricedTopping
+}
+
+// priceItems resolves names and prices for the requested lines from the
+// menu tables. Every problem found is collected into a single
+// ValidationError so the till can show them all at once.
+func (s *InvoiceService) priceItems(tx *sql.Tx, items []models.CreateInvoiceItemInput) ([]pricedItem, error) {
+	verr := &ValidationError{}
+	if len(items) == 0 {
+		verr.Add("items", "order must contain at least one item")
+	}
+
+	priced := make([]pricedItem, 0, len(items))
+	for i, input := range items {
+		field := fmt.Sprintf("items[%d]", i)
+		if input.Quantity <= 0 {
+			verr.Add(field+".quantity", "must be greater than zero")
+		}
+
+		line := pricedItem{ItemID: input.ItemID, Quantity: input.Quantity}
+		var (
+			isAvailable bool
+			soldOut     bool
+			price       *models.Money
+		)
+		err := tx.QueryRow(`
+			SELECT name, category, is_available, sold_out, price
+			FROM items WHERE id = $1
+		`, input.ItemID).Scan(&line.ItemName, &line.Category, &isAvailable, &soldOut, &price)
+		if err == sql.ErrNoRows {
+			verr.Add(field+".item_id", "item %d does not exist", input.ItemID)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if soldOut {
+			verr.Add(field+".item_id", "%s is sold out", line.ItemName)
+			continue
+		}
+		if !isAvailable {
+			verr.Add(field+".item_id", "%s is not available", line.ItemName)
+			continue
+		}
+
+		if line.Category == "pizza" {
+			if !pizzaSizes[input.Size] {
+				verr.Add(field+".size", "must be one of small, medium, large")
+				continue
+			}
+			err = tx.QueryRow(`
+				SELECT price FROM pizza_base_prices
+				WHERE item_id = $1 AND size = $2
+			`, input.ItemID, input.Size).Scan(&line.UnitPrice)
+			if err == sql.ErrNoRows {
+				verr.Add(field+".size", "%s has no %s price", line.ItemName, input.Size)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			size := input.Size
+			line.Size = &size
+		} else {
+			if input.Size != "" {
+				verr.Add(field+".size", "sizes only apply to pizzas")
+			}
+			if len(input.Toppings) > 0 {
+				verr.Add(field+".toppings", "toppings only apply to pizzas")
+			}
+			if price == nil {
+				verr.Add(field+".item_id", "%s has no price", line.ItemName)
+				continue
+			}
+			line.UnitPrice = *price
+		}
+
+		for j, input := range input.Toppings {
+			toppingField := fmt.Sprintf("%s.toppings[%d]", field, j)
+			if input.Quantity <= 0 {
+				verr.Add(toppingField+".quantity", "must be greater than zero")
+			}
+
+			topping := pricedTopping{ToppingID: input.ToppingID, Quantity: input.Quantity}
+			var available, soldOut bool
+			err := tx.QueryRow(`
+				SELECT name, price, is_available, sold_out
+				FROM toppings WHERE id = $1
+			`, input.ToppingID).Scan(&topping.Name, &topping.Price, &available, &soldOut)
+			if err == sql.ErrNoRows {
+				verr.Add(toppingField+".topping_id", "topping %d does not exist", input.ToppingID)
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if soldOut {
+				verr.Add(toppingField+".topping_id", "%s is sold out", topping.Name)
+				continue
+			}
+			if !available {
+				verr.Add(toppingField+".topping_id", "%s is not available", topping.Name)
+				continue
+			}
+			line.Toppings = append(line.Toppings, topping)
+		}
+
+		priced = append(priced, line)
+	}
+
+	if verr.HasProblems() {
+		return nil, verr
+	}
+	return priced, nil
+}
+
+// calculateLineAmounts fills in the per-line breakdown from the unit price,
+// quantity and toppings. Topping quantities are per item, so each topping
+// is charged Price * Quantity * item quantity.
+func calculateLineAmounts(item *models.InvoiceItem) {
+	item.ToppingsPrice = 0
+	for i := range item.Toppings {
+		topping := &item.Toppings[i]
+		item.ToppingsPrice += topping.Price.Mul(topping.Quantity)
+		topping.Subtotal = topping.Price.Mul(topping.Quantity).Mul(item.Quantity)
+	}
+	item.BaseAmount = item.UnitPrice.Mul(item.Quantity)
+	item.ToppingsAmount = item.ToppingsPrice.Mul(item.Quantity)
+	item.Subtotal = item.BaseAmount + item.ToppingsAmount
+}
+
+func (s *InvoiceService) CreateInvoice(input models.CreateInvoiceInput, actor models.Actor) (*models.Invoice, error) {
 	tx, err := config.DB.Begin()
 	if err != nil {
 		return nil, err
 	}
 	defer tx.Rollback()
 
+	lines, err := s.priceItems(tx, input.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the invoice lines, snapshotting names and prices so later menu
+	// edits don't rewrite order history
+	items := make([]models.InvoiceItem, len(lines))
+	for i, line := range lines {
+		itemID := line.ItemID
+		items[i] = models.InvoiceItem{
+			ItemID:    &itemID,
+			ItemName:  line.ItemName,
+			Size:      line.Size,
+			Quantity:  line.Quantity,
+			UnitPrice: line.UnitPrice,
+		}
+		for _, topping := range line.Toppings {
+			items[i].Toppings = append(items[i].Toppings, models.InvoiceItemTopping{
+				ToppingID: topping.ToppingID,
+				Name:      topping.Name,
+				Quantity:  topping.Quantity,
+				Price:     topping.Price,
+			})
+		}
+		calculateLineAmounts(&items[i])
+	}
+
 	// Calculate total amount and tax
-	var totalAmount float64 = 0
-	for _, item := range input.Items {
-		itemTotal := item.UnitPrice * float64(item.Quantity)
-		totalAmount += itemTotal
+	var totalAmount models.Money = 0
+	taxable := make([]taxableLine, len(items))
+	for i, item := range items {
+		totalAmount += item.Subtotal
+		taxable[i] = taxableLine{Category: lines[i].Category, Amount: item.Subtotal}
 	}
 
-	taxAmount := totalAmount * 0.05 // 5% tax
+	taxes, err := calculateTaxes(tx, taxable)
+	if err != nil {
+		return nil, err
+	}
+
+	taxAmount := exclusiveTax(taxes)
+
+	orderNo, err := allocateOrderNo(tx, time.Now())
+	if err != nil {
+		return nil, err
+	}
 
 	// Create invoice
 	var invoice models.Invoice
 	err = tx.QueryRow(`
-        INSERT INTO invoices (order_no, total_amount, tax_amount, status)
-        VALUES ($1, $2, $3, 'completed')
-        RETURNING id, order_no, total_amount, tax_amount, status, created_at
-    `, input.OrderNo, totalAmount, taxAmount).Scan(
+        INSERT INTO invoices (order_no, total_amount, tax_amount, status, cashier_id, terminal_id)
+        VALUES ($1, $2, $3, 'open', $4, $5)
+        RETURNING id, order_no, total_amount, tax_amount, status, created_at, cashier_id, terminal_id
+    `, orderNo, totalAmount, taxAmount, input.CashierID, input.TerminalID).Scan(
 		&invoice.ID,
 		&invoice.OrderNo,
 		&invoice.TotalAmount,
 		&invoice.TaxAmount,
 		&invoice.Status,
 		&invoice.CreatedAt,
+		&invoice.CashierID,
+		&invoice.TerminalID,
 	)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" && pqErr.Constraint == "invoices_order_no_key" {
+			return nil, ErrOrderNoConflict
+		}
+		return nil, err
+	}
+
+	err = appendStatusHistory(tx, invoice.ID, "", invoice.Status)
 	if err != nil {
 		return nil, err
 	}
 
+	// Record which tax rules were applied
+	for _, tax := range taxes {
+		tax.InvoiceID = invoice.ID
+		err = tx.QueryRow(`
+            INSERT INTO invoice_taxes (invoice_id, tax_rule_id, name, kind, rate, inclusive, category, taxable_amount, amount)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+            RETURNING id
+        `, invoice.ID, tax.TaxRuleID, tax.Name, tax.Kind, tax.Rate, tax.Inclusive, tax.Category,
+			tax.TaxableAmount, tax.Amount).Scan(&tax.ID)
+		if err != nil {
+			return nil, err
+		}
+		invoice.Taxes = append(invoice.Taxes, tax)
+	}
+
 	// Create invoice items
-	for _, item := range input.Items {
-		var invoiceItemID int
+	for i, item := range items {
+		item.InvoiceID = invoice.ID
 		err = tx.QueryRow(`
-            INSERT INTO invoice_items (invoice_id, item_name, quantity, unit_price, subtotal)
-            VALUES ($1, $2, $3, $4, $5)
+            INSERT INTO invoice_items (invoice_id, item_id, item_name, category, size, quantity, unit_price, subtotal)
+            VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
             RETURNING id
-        `, invoice.ID, item.ItemName, item.Quantity, item.UnitPrice,
-			item.UnitPrice*float64(item.Quantity)).Scan(&invoiceItemID)
+        `, invoice.ID, item.ItemID, item.ItemName, lines[i].Category, item.Size, item.Quantity, item.UnitPrice,
+			item.Subtotal).Scan(&item.ID)
 		if err != nil {
 			return nil, err
 		}
 
 		// Insert toppings if any
-		for _, topping := range item.Toppings {
-			_, err = tx.Exec(`
-                INSERT INTO invoice_item_toppings (invoice_item_id, topping_id, quantity, price)
-                VALUES ($1, $2, $3, (SELECT price FROM toppings WHERE id = $2))
-            `, invoiceItemID, topping.ToppingID, topping.Quantity)
+		for i := range item.Toppings {
+			topping := &item.Toppings[i]
+			err = tx.QueryRow(`
+                INSERT INTO invoice_item_toppings (invoice_item_id, topping_id, name, quantity, price)
+                VALUES ($1, $2, $3, $4, $5)
+                RETURNING id
+            `, item.ID, topping.ToppingID, topping.Name, topping.Quantity, topping.Price).Scan(&topping.ID)
 			if err != nil {
 				return nil, err
 			}
 		}
+
+		invoice.Items = append(invoice.Items, item)
+	}
+
+	categories := make([]string, len(lines))
+	for i, line := range lines {
+		categories[i] = line.Category
+	}
+	if err := createKitchenTickets(tx, invoice.ID, invoice.Items, categories); err != nil {
+		return nil, err
 	}
 
-	err = tx.Commit()
+	invoice.StatusHistory, err = getStatusHistory(tx, invoice.ID)
 	if err != nil {
 		return nil, err
 	}
 
+	invoice.AmountDue = invoice.TotalAmount + invoice.TaxAmount
+	invoice.BalanceDue = invoice.AmountDue
+
+	var pending pendingEvents
+	pending.add(events.InvoiceCreated, invoice)
+
+	if err := depleteStock(tx, lines, &pending); err != nil {
+		return nil, err
+	}
+
+	err = recordAudit(tx, actor, models.AuditInvoiceCreated, models.AuditEntityInvoice, invoice.ID, nil, invoice)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pending.commit(tx); err != nil {
+		return nil, err
+	}
+
+	pending.publish()
+	publishInvoiceTickets(invoice.ID)
+
 	return &invoice, nil
 }
 
-func (s *InvoiceService) GetInvoice(id int) (*models.Invoice, error) {
+// getInvoiceHeader loads an invoice with its taxes, status history, credit
+// notes and payments but without line items.
+func (s *InvoiceService) getInvoiceHeader(id int) (*models.Invoice, error) {
 	var invoice models.Invoice
 	err := config.DB.QueryRow(`
-        SELECT id, order_no, total_amount, tax_amount, status, created_at
+        SELECT id, order_no, total_amount, tax_amount, status, created_at, cashier_id, terminal_id, paid_at
         FROM invoices WHERE id = $1
     `, id).Scan(
 		&invoice.ID,
@@ -87,101 +342,151 @@ func (s *InvoiceService) GetInvoice(id int) (*models.Invoice, error) {
 		&invoice.TaxAmount,
 		&invoice.Status,
 		&invoice.CreatedAt,
+		&invoice.CashierID,
+		&invoice.TerminalID,
+		&invoice.PaidAt,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get invoice items
-	rows, err := config.DB.Query(`
-        SELECT ii.id, ii.ItemName, i.name, ii.quantity, ii.unit_price, ii.subtotal
-        FROM invoice_items ii
-        JOIN items i ON i.id = ii.item_id
-        WHERE ii.invoice_id = $1
-    `, id)
+	invoice.Taxes, err = getInvoiceTaxes(id)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var item models.InvoiceItem
-		err := rows.Scan(
-			&item.ID,
-			&item.ItemName,
-			&item.Quantity,
-			&item.UnitPrice,
-			&item.Subtotal,
-		)
-		if err != nil {
-			return nil, err
-		}
+	invoice.StatusHistory, err = getStatusHistory(config.DB, id)
+	if err != nil {
+		return nil, err
+	}
 
-		// Get toppings for each item
-		toppingRows, err := config.DB.Query(`
-            SELECT iit.id, iit.topping_id, t.name, iit.quantity, iit.price
-            FROM invoice_item_toppings iit
-            JOIN toppings t ON t.id = iit.topping_id
-            WHERE iit.invoice_item_id = $1
-        `, item.ID)
-		if err != nil {
-			return nil, err
-		}
-		defer toppingRows.Close()
-
-		for toppingRows.Next() {
-			var topping models.InvoiceItemTopping
-			err := toppingRows.Scan(
-				&topping.ID,
-				&topping.ToppingID,
-				&topping.Name,
-				&topping.Quantity,
-				&topping.Price,
-			)
-			if err != nil {
-				return nil, err
-			}
-			item.Toppings = append(item.Toppings, topping)
-		}
+	invoice.CreditNotes, err = getCreditNotes(id)
+	if err != nil {
+		return nil, err
+	}
 
-		invoice.Items = append(invoice.Items, item)
+	invoice.Payments, err = getPayments(id)
+	if err != nil {
+		return nil, err
 	}
 
+	balance, err := getInvoiceBalance(config.DB, id)
+	if err != nil {
+		return nil, err
+	}
+	invoice.AmountDue = balance.Due
+	invoice.AmountPaid = balance.Paid
+	invoice.BalanceDue = balance.Outstanding()
+
 	return &invoice, nil
 }
 
-func (s *InvoiceService) GetLatestOrderNo() (string, error) {
-	var lastOrderNo string
-	err := config.DB.QueryRow(`
-		SELECT COALESCE(MAX(order_no), '9999') 
-		FROM invoices
-	`).Scan(&lastOrderNo)
-
+// GetInvoice returns an invoice with all of its lines and toppings. It runs
+// a fixed number of queries however many lines the invoice has.
+func (s *InvoiceService) GetInvoice(id int) (*models.Invoice, error) {
+	invoice, err := s.getInvoiceHeader(id)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if lastOrderNo == "9999" {
-		return "10000", nil
+	invoice.Items, err = s.GetInvoiceItems(id)
+	if err != nil {
+		return nil, err
 	}
 
-	// Convert to integer, increment, and format back to string
-	orderNum, _ := strconv.Atoi(lastOrderNo)
-	return strconv.Itoa(orderNum + 1), nil
+	return invoice, nil
 }
 
-func (s *InvoiceService) GetAllInvoices() ([]models.Invoice, error) {
-	rows, err := config.DB.Query(`
-		SELECT id, order_no, total_amount, tax_amount, status, created_at
+// GetLatestOrderNo previews the next order number for display on the till.
+// The number is only reserved when the order is placed, so another till
+// may still take it first.
+func (s *InvoiceService) GetLatestOrderNo() (string, error) {
+	return peekOrderNo(time.Now())
+}
+
+// GetAllInvoices returns one page of invoices matching the filter, newest
+// first, with the total number of matches.
+func (s *InvoiceService) GetAllInvoices(filter models.InvoiceFilter) (*models.InvoicePage, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", fmt.Sprintf("$%d", len(args))))
+	}
+
+	if filter.From != nil {
+		where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		where("created_at < ?", *filter.To)
+	}
+	if filter.Status != "" {
+		where("status = ?", filter.Status)
+	}
+	if filter.OrderNo != "" {
+		where("order_no = ?", filter.OrderNo)
+	}
+	if filter.MinTotal != nil {
+		where("total_amount >= ?", *filter.MinTotal)
+	}
+	if filter.MaxTotal != nil {
+		where("total_amount <= ?", *filter.MaxTotal)
+	}
+	if filter.CashierID != nil {
+		where("cashier_id = ?", *filter.CashierID)
+	}
+	if filter.TerminalID != nil {
+		where("terminal_id = ?", *filter.TerminalID)
+	}
+	if filter.ItemName != "" {
+		where(`EXISTS (SELECT 1 FROM invoice_items ii
+		               WHERE ii.invoice_id = invoices.id AND ii.item_name ILIKE '%' || ? || '%')`, filter.ItemName)
+	}
+
+	page := models.InvoicePage{Data: []models.Invoice{}, Limit: filter.Limit}
+
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	err := config.DB.QueryRow("SELECT COUNT(*) FROM invoices "+whereClause, args...).Scan(&page.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	// The cursor continues after the last invoice of the previous page
+	offset := 0
+	if filter.Cursor != "" {
+		createdAt, id, err := decodeInvoiceCursor(filter.Cursor)
+		if err != nil {
+			verr := &ValidationError{}
+			verr.Add("cursor", "is not valid")
+			return nil, verr
+		}
+		args = append(args, createdAt, id)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)-1, len(args)))
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	} else {
+		page.Page = filter.Page
+		offset = (filter.Page - 1) * filter.Limit
+	}
+
+	// Fetch one extra row to know whether there is another page
+	args = append(args, filter.Limit+1, offset)
+	rows, err := config.DB.Query(fmt.Sprintf(`
+		SELECT id, order_no, total_amount, tax_amount, status, created_at, cashier_id, terminal_id, paid_at
 		FROM invoices
-		ORDER BY created_at DESC
-	`)
+		%s
+		ORDER BY created_at DESC, id DESC
+		LIMIT $%d OFFSET $%d
+	`, whereClause, len(args)-1, len(args)), args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var invoices []models.Invoice
 	for rows.Next() {
 		var invoice models.Invoice
 		err := rows.Scan(
@@ -191,19 +496,56 @@ func (s *InvoiceService) GetAllInvoices() ([]models.Invoice, error) {
 			&invoice.TaxAmount,
 			&invoice.Status,
 			&invoice.CreatedAt,
+			&invoice.CashierID,
+			&invoice.TerminalID,
+			&invoice.PaidAt,
 		)
 		if err != nil {
 			return nil, err
 		}
-		invoices = append(invoices, invoice)
+		page.Data = append(page.Data, invoice)
 	}
 
-	return invoices, nil
+	if len(page.Data) > filter.Limit {
+		page.Data = page.Data[:filter.Limit]
+		last := page.Data[len(page.Data)-1]
+		cursor := encodeInvoiceCursor(last.CreatedAt, last.ID)
+		page.NextCursor = &cursor
+	}
+
+	return &page, nil
+}
+
+func encodeInvoiceCursor(createdAt time.Time, id int) string {
+	raw := createdAt.Format(time.RFC3339Nano) + "," + strconv.Itoa(id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeInvoiceCursor(cursor string) (time.Time, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	createdAtText, idText, found := strings.Cut(string(raw), ",")
+	if !found {
+		return time.Time{}, 0, fmt.Errorf("malformed cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtText)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	id, err := strconv.Atoi(idText)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return createdAt, id, nil
 }
 
+// GetInvoiceItems returns the lines of an invoice with their toppings,
+// using one query for the lines and one for all of their toppings.
 func (s *InvoiceService) GetInvoiceItems(invoiceID int) ([]models.InvoiceItem, error) {
 	rows, err := config.DB.Query(`
-		SELECT ii.id, ii.invoice_id, ii.item_name, ii.quantity, ii.unit_price, ii.subtotal
+		SELECT ii.id, ii.invoice_id, ii.item_id, ii.item_name, ii.size, ii.quantity, ii.unit_price, ii.subtotal
 		FROM invoice_items ii
 		WHERE ii.invoice_id = $1
 		ORDER BY ii.id ASC
@@ -214,12 +556,15 @@ func (s *InvoiceService) GetInvoiceItems(invoiceID int) ([]models.InvoiceItem, e
 	defer rows.Close()
 
 	var items []models.InvoiceItem
+	var itemIDs []int64
 	for rows.Next() {
 		var item models.InvoiceItem
 		err := rows.Scan(
 			&item.ID,
 			&item.InvoiceID,
+			&item.ItemID,
 			&item.ItemName,
+			&item.Size,
 			&item.Quantity,
 			&item.UnitPrice,
 			&item.Subtotal,
@@ -227,36 +572,67 @@ func (s *InvoiceService) GetInvoiceItems(invoiceID int) ([]models.InvoiceItem, e
 		if err != nil {
 			return nil, err
 		}
+		items = append(items, item)
+		itemIDs = append(itemIDs, int64(item.ID))
+	}
+	rows.Close()
+
+	toppings, err := getToppingsForItems(itemIDs)
+	if err != nil {
+		return nil, err
+	}
 
-		// Get toppings for each item
-		toppingRows, err := config.DB.Query(`
-			SELECT iit.id, iit.topping_id, t.name, iit.quantity, iit.price
-			FROM invoice_item_toppings iit
-			JOIN toppings t ON t.id = iit.topping_id
-			WHERE iit.invoice_item_id = $1
-		`, item.ID)
+	for i := range items {
+		item := &items[i]
+		item.Toppings = toppings[item.ID]
+
+		// Subtotal is stored; only the breakdown is derived
+		subtotal := item.Subtotal
+		calculateLineAmounts(item)
+		item.Subtotal = subtotal
+	}
+
+	return items, nil
+}
+
+// getToppingsForItems fetches the toppings of many invoice items in a single
+// query, keyed by invoice item ID.
+func getToppingsForItems(invoiceItemIDs []int64) (map[int][]models.InvoiceItemTopping, error) {
+	toppings := make(map[int][]models.InvoiceItemTopping)
+	if len(invoiceItemIDs) == 0 {
+		return toppings, nil
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT iit.id, iit.invoice_item_id, iit.topping_id, COALESCE(iit.name, t.name), iit.quantity, iit.price
+		FROM invoice_item_toppings iit
+		JOIN toppings t ON t.id = iit.topping_id
+		WHERE iit.invoice_item_id = ANY($1)
+		ORDER BY iit.id ASC
+	`, pq.Array(invoiceItemIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			topping       models.InvoiceItemTopping
+			invoiceItemID int
+		)
+		err := rows.Scan(
+			&topping.ID,
+			&invoiceItemID,
+			&topping.ToppingID,
+			&topping.Name,
+			&topping.Quantity,
+			&topping.Price,
+		)
 		if err != nil {
 			return nil, err
 		}
-		defer toppingRows.Close()
-
-		for toppingRows.Next() {
-			var topping models.InvoiceItemTopping
-			err := toppingRows.Scan(
-				&topping.ID,
-				&topping.ToppingID,
-				&topping.Name,
-				&topping.Quantity,
-				&topping.Price,
-			)
-			if err != nil {
-				return nil, err
-			}
-			item.Toppings = append(item.Toppings, topping)
-		}
-
-		items = append(items, item)
+		toppings[invoiceItemID] = append(toppings[invoiceItemID], topping)
 	}
 
-	return items, nil
+	return toppings, nil
 }
@@ -0,0 +1,236 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"pizza-shop/models"
+	"testing"
+)
+
+func TestCalculateLineAmounts(t *testing.T) {
+	tests := []struct {
+		name         string
+		item         models.InvoiceItem
+		wantToppings models.Money
+		wantBase     models.Money
+		wantSubtotal models.Money
+	}{
+		{
+			name:         "no toppings",
+			item:         models.InvoiceItem{Quantity: 3, UnitPrice: 250},
+			wantToppings: 0,
+			wantBase:     750,
+			wantSubtotal: 750,
+		},
+		{
+			name: "toppings per item",
+			item: models.InvoiceItem{
+				Quantity:  2,
+				UnitPrice: 1299,
+				Toppings: []models.InvoiceItemTopping{
+					{Name: "Olives", Quantity: 1, Price: 75},
+					{Name: "Extra cheese", Quantity: 2, Price: 149},
+				},
+			},
+			wantToppings: 373,
+			wantBase:     2598,
+			wantSubtotal: 3344,
+		},
+		{
+			name: "free topping",
+			item: models.InvoiceItem{
+				Quantity:  1,
+				UnitPrice: 999,
+				Toppings:  []models.InvoiceItemTopping{{Name: "Basil", Quantity: 1, Price: 0}},
+			},
+			wantToppings: 0,
+			wantBase:     999,
+			wantSubtotal: 999,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := tt.item
+			calculateLineAmounts(&item)
+
+			if item.ToppingsPrice != tt.wantToppings {
+				t.Errorf("toppings price = %s, want %s", item.ToppingsPrice, tt.wantToppings)
+			}
+			if item.BaseAmount != tt.wantBase {
+				t.Errorf("base amount = %s, want %s", item.BaseAmount, tt.wantBase)
+			}
+			if item.Subtotal != tt.wantSubtotal {
+				t.Errorf("subtotal = %s, want %s", item.Subtotal, tt.wantSubtotal)
+			}
+			if item.BaseAmount+item.ToppingsAmount != item.Subtotal {
+				t.Errorf("base %s + toppings %s != subtotal %s", item.BaseAmount, item.ToppingsAmount, item.Subtotal)
+			}
+
+			var toppings models.Money
+			for _, topping := range item.Toppings {
+				toppings += topping.Subtotal
+			}
+			if toppings != item.ToppingsAmount {
+				t.Errorf("topping subtotals add up to %s, want %s", toppings, item.ToppingsAmount)
+			}
+		})
+	}
+}
+
+// TestInvoiceTotalsReconcile prices an order the way CreateInvoice does and
+// checks the lines, taxes and amount due agree to the cent.
+func TestInvoiceTotalsReconcile(t *testing.T) {
+	pizza := "pizza"
+	rules := []models.TaxRule{
+		{ID: 1, Name: "Sales tax", Kind: models.TaxKindPercentage, Rate: mustRate(t, "8.875")},
+		{ID: 2, Name: "VAT", Kind: models.TaxKindPercentage, Rate: mustRate(t, "20"), Inclusive: true},
+		{ID: 3, Name: "Pizza levy", Kind: models.TaxKindPercentage, Rate: mustRate(t, "1.5"), Category: &pizza},
+		{ID: 4, Name: "Bag charge", Kind: models.TaxKindFixed, Rate: mustRate(t, "0.10")},
+	}
+	items := []models.InvoiceItem{
+		{
+			Quantity:  3,
+			UnitPrice: 1333,
+			Toppings: []models.InvoiceItemTopping{
+				{Name: "Pepperoni", Quantity: 1, Price: 117},
+				{Name: "Jalapeños", Quantity: 3, Price: 33},
+			},
+		},
+		{Quantity: 1, UnitPrice: 1099},
+		{Quantity: 7, UnitPrice: 149},
+	}
+	categories := []string{"pizza", "pizza", "drinks"}
+
+	var totalAmount models.Money
+	taxable := make([]taxableLine, len(items))
+	for i := range items {
+		calculateLineAmounts(&items[i])
+		totalAmount += items[i].Subtotal
+		taxable[i] = taxableLine{Category: categories[i], Amount: items[i].Subtotal}
+	}
+	taxes := applyTaxRules(rules, taxable)
+	taxAmount := exclusiveTax(taxes)
+
+	// (13.33 + 1.17 + 0.99) * 3 + 10.99 + 1.49 * 7
+	if totalAmount != 6789 {
+		t.Errorf("total = %s, want 67.89", totalAmount)
+	}
+
+	want := map[string]models.Money{
+		"Sales tax":  603,  // 602.52375
+		"VAT":        1132, // 1131.5, already in the prices
+		"Pizza levy": 86,   // 86.19 on the pizzas only
+		"Bag charge": 10,
+	}
+	if len(taxes) != len(want) {
+		t.Fatalf("got %d taxes, want %d", len(taxes), len(want))
+	}
+	var exclusive models.Money
+	for _, tax := range taxes {
+		if tax.Amount != want[tax.Name] {
+			t.Errorf("%s = %s, want %s", tax.Name, tax.Amount, want[tax.Name])
+		}
+		if !tax.Inclusive {
+			exclusive += tax.Amount
+		}
+	}
+	if taxAmount != exclusive || taxAmount != 699 {
+		t.Errorf("tax = %s, want 6.99", taxAmount)
+	}
+
+	// What the customer pays is the line totals plus the exclusive taxes,
+	// with no cent gained or lost along the way
+	if due := totalAmount + taxAmount; due != 7488 {
+		t.Errorf("amount due = %s, want 74.88", due)
+	}
+}
+
+func TestGetInvoice(t *testing.T) {
+	db := useTestDB(t)
+	order := createTestOrder(t, db, 2, 3)
+
+	service := &InvoiceService{}
+	invoice, err := service.GetInvoice(order.invoiceID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if invoice.ID != order.invoiceID || invoice.Status != "open" {
+		t.Errorf("got invoice %d in status %q, want %d in status open", invoice.ID, invoice.Status, order.invoiceID)
+	}
+	if invoice.TotalAmount != 3300 || invoice.TaxAmount != 330 {
+		t.Errorf("total %s tax %s, want 33.00 and 3.30", invoice.TotalAmount, invoice.TaxAmount)
+	}
+	if invoice.AmountDue != 3630 || invoice.BalanceDue != 3630 || invoice.AmountPaid != 0 {
+		t.Errorf("due %s balance %s paid %s, want 36.30, 36.30 and 0.00", invoice.AmountDue, invoice.BalanceDue, invoice.AmountPaid)
+	}
+	if len(invoice.Taxes) != 1 || invoice.Taxes[0].Amount != 330 {
+		t.Errorf("taxes = %+v, want one of 3.30", invoice.Taxes)
+	}
+	if len(invoice.StatusHistory) != 1 {
+		t.Errorf("got %d status changes, want 1", len(invoice.StatusHistory))
+	}
+
+	if len(invoice.Items) != len(order.lineIDs) {
+		t.Fatalf("got %d lines, want %d", len(invoice.Items), len(order.lineIDs))
+	}
+	for i, item := range invoice.Items {
+		if item.ID != order.lineIDs[i] {
+			t.Errorf("line %d has id %d, want %d", i, item.ID, order.lineIDs[i])
+		}
+		if len(item.Toppings) != len(order.toppingIDs) {
+			t.Errorf("line %d has %d toppings, want %d", i, len(item.Toppings), len(order.toppingIDs))
+			continue
+		}
+		for j, topping := range item.Toppings {
+			if topping.ToppingID != order.toppingIDs[j] {
+				t.Errorf("line %d topping %d is %d, want %d", i, j, topping.ToppingID, order.toppingIDs[j])
+			}
+		}
+		if item.ToppingsPrice != 450 || item.BaseAmount+item.ToppingsAmount != item.Subtotal || item.Subtotal != 1650 {
+			t.Errorf("line %d: toppings %s base %s subtotal %s, want 4.50, 12.00 and 16.50",
+				i, item.ToppingsPrice, item.BaseAmount, item.Subtotal)
+		}
+	}
+}
+
+func TestGetInvoiceNotFound(t *testing.T) {
+	useTestDB(t)
+
+	service := &InvoiceService{}
+	if _, err := service.GetInvoice(-1); err != sql.ErrNoRows {
+		t.Errorf("got error %v, want sql.ErrNoRows", err)
+	}
+}
+
+// BenchmarkGetInvoiceItems shows an invoice's lines and toppings are read
+// with the same number of queries however many lines there are.
+func BenchmarkGetInvoiceItems(b *testing.B) {
+	db := useTestDB(b)
+	service := &InvoiceService{}
+
+	for _, lines := range []int{1, 10, 100} {
+		order := createTestOrder(b, db, lines, 3)
+
+		b.Run(fmt.Sprintf("lines=%d", lines), func(b *testing.B) {
+			testQueries.Store(0)
+			for i := 0; i < b.N; i++ {
+				items, err := service.GetInvoiceItems(order.invoiceID)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(items) != lines || len(items[0].Toppings) != 3 {
+					b.Fatalf("got %d lines with %d toppings, want %d with 3", len(items), len(items[0].Toppings), lines)
+				}
+			}
+
+			// One query for the lines and one for all their toppings
+			queries := float64(testQueries.Load()) / float64(b.N)
+			b.ReportMetric(queries, "queries/op")
+			if queries != 2 {
+				b.Errorf("%v queries per call, want 2", queries)
+			}
+		})
+	}
+}
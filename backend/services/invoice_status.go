@@ -0,0 +1,156 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"pizza-shop/config"
+	"pizza-shop/events"
+	"pizza-shop/models"
+)
+
+// invoiceTransitions lists the statuses an invoice may move to from each
+// status. Voided and refunded are final. Orders are often paid for before
+// they're made, so one can be refunded before it's completed.
+var invoiceTransitions = map[string][]string{
+	models.InvoiceStatusOpen:      {models.InvoiceStatusPreparing, models.InvoiceStatusCompleted, models.InvoiceStatusVoided, models.InvoiceStatusRefunded},
+	models.InvoiceStatusPreparing: {models.InvoiceStatusReady, models.InvoiceStatusVoided, models.InvoiceStatusRefunded},
+	models.InvoiceStatusReady:     {models.InvoiceStatusCompleted, models.InvoiceStatusVoided, models.InvoiceStatusRefunded},
+	models.InvoiceStatusCompleted: {models.InvoiceStatusRefunded},
+	models.InvoiceStatusVoided:    {},
+	models.InvoiceStatusRefunded:  {},
+}
+
+// InvalidTransitionError is returned for a status change the lifecycle
+// doesn't allow, e.g. refunding a voided order. Controllers map it to
+// 409 Conflict.
+type InvalidTransitionError struct {
+	From string
+	To   string
+}
+
+func (e *InvalidTransitionError) Error() string {
+	return fmt.Sprintf("cannot change invoice status from %s to %s", e.From, e.To)
+}
+
+func canTransition(from, to string) bool {
+	for _, allowed := range invoiceTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// lockInvoiceStatus reads the current status and locks the invoice row
+// until tx ends, so concurrent status changes are applied one at a time.
+func lockInvoiceStatus(tx *sql.Tx, invoiceID int) (string, error) {
+	var status string
+	err := tx.QueryRow(`
+		SELECT status FROM invoices WHERE id = $1 FOR UPDATE
+	`, invoiceID).Scan(&status)
+	return status, err
+}
+
+// appendStatusHistory records a status transition. from is empty for a
+// newly created invoice.
+func appendStatusHistory(tx *sql.Tx, invoiceID int, from, to string) error {
+	var fromStatus *string
+	if from != "" {
+		fromStatus = &from
+	}
+	_, err := tx.Exec(`
+		INSERT INTO invoice_status_history (invoice_id, from_status, to_status)
+		VALUES ($1, $2, $3)
+	`, invoiceID, fromStatus, to)
+	return err
+}
+
+// changeStatus moves a locked invoice to a new status if the lifecycle
+// allows it, recording actor in the audit log. The change is announced once
+// the caller publishes pending.
+func changeStatus(tx *sql.Tx, invoiceID int, to string, pending *pendingEvents, actor models.Actor) error {
+	from, err := lockInvoiceStatus(tx, invoiceID)
+	if err != nil {
+		return err
+	}
+	if !canTransition(from, to) {
+		return &InvalidTransitionError{From: from, To: to}
+	}
+
+	_, err = tx.Exec(`UPDATE invoices SET status = $1 WHERE id = $2`, to, invoiceID)
+	if err != nil {
+		return err
+	}
+	pending.add(events.InvoiceStatusChanged, events.StatusChange{InvoiceID: invoiceID, From: from, To: to})
+
+	err = recordAudit(tx, actor, models.AuditInvoiceStatusChanged, models.AuditEntityInvoice, invoiceID,
+		map[string]string{"status": from}, map[string]string{"status": to})
+	if err != nil {
+		return err
+	}
+	return appendStatusHistory(tx, invoiceID, from, to)
+}
+
+func (s *InvoiceService) UpdateStatus(id int, status string, actor models.Actor) (*models.Invoice, error) {
+	if _, known := invoiceTransitions[status]; !known {
+		verr := &ValidationError{}
+		verr.Add("status", "unknown status %q", status)
+		return nil, verr
+	}
+	if status == models.InvoiceStatusVoided || status == models.InvoiceStatusRefunded {
+		// These need a credit note so the day's totals stay correct
+		verr := &ValidationError{}
+		verr.Add("status", "use the void or refund endpoint to mark an invoice %s", status)
+		return nil, verr
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var pending pendingEvents
+	if err := changeStatus(tx, id, status, &pending, actor); err != nil {
+		return nil, err
+	}
+
+	if err := pending.commit(tx); err != nil {
+		return nil, err
+	}
+
+	pending.publish()
+	publishInvoiceTickets(id)
+	return s.getInvoiceHeader(id)
+}
+
+func getStatusHistory(q querier, invoiceID int) ([]models.InvoiceStatusChange, error) {
+	rows, err := q.Query(`
+		SELECT id, invoice_id, from_status, to_status, changed_at
+		FROM invoice_status_history
+		WHERE invoice_id = $1
+		ORDER BY changed_at, id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.InvoiceStatusChange
+	for rows.Next() {
+		var change models.InvoiceStatusChange
+		err := rows.Scan(
+			&change.ID,
+			&change.InvoiceID,
+			&change.FromStatus,
+			&change.ToStatus,
+			&change.ChangedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+
+	return history, nil
+}
@@ -3,17 +3,35 @@ package services
 import (
 	"database/sql"
 	"pizza-shop/config"
+	"pizza-shop/events"
 	"pizza-shop/models"
 	"time"
 )
 
 type ItemService struct{}
 
+const itemColumns = `id, name, category, description, is_available, sold_out, stock_count, price, image_path, created_at`
+
+func scanItem(row interface{ Scan(...interface{}) error }, item *models.Item) error {
+	return row.Scan(
+		&item.ID,
+		&item.Name,
+		&item.Category,
+		&item.Description,
+		&item.IsAvailable,
+		&item.SoldOut,
+		&item.StockCount,
+		&item.Price,
+		&item.ImagePath,
+		&item.CreatedAt,
+	)
+}
+
 func (s *ItemService) GetAllItems() ([]models.Item, error) {
 	var items []models.Item
 
 	rows, err := config.DB.Query(`
-        SELECT id, name, category, description, is_available, price, image_path, created_at 
+        SELECT ` + itemColumns + `
         FROM items
     `)
 	if err != nil {
@@ -23,17 +41,7 @@ func (s *ItemService) GetAllItems() ([]models.Item, error) {
 
 	for rows.Next() {
 		var item models.Item
-		err := rows.Scan(
-			&item.ID,
-			&item.Name,
-			&item.Category,
-			&item.Description,
-			&item.IsAvailable,
-			&item.Price,
-			&item.ImagePath,
-			&item.CreatedAt,
-		)
-		if err != nil {
+		if err := scanItem(rows, &item); err != nil {
 			return nil, err
 		}
 		items = append(items, item)
@@ -46,8 +54,8 @@ func (s *ItemService) GetItemsByCategory(category string) ([]models.Item, error)
 	var items []models.Item
 
 	rows, err := config.DB.Query(`
-        SELECT id, name, category, description, is_available, price, image_path, created_at 
-        FROM items 
+        SELECT `+itemColumns+`
+        FROM items
         WHERE category = $1
     `, category)
 	if err != nil {
@@ -57,17 +65,7 @@ func (s *ItemService) GetItemsByCategory(category string) ([]models.Item, error)
 
 	for rows.Next() {
 		var item models.Item
-		err := rows.Scan(
-			&item.ID,
-			&item.Name,
-			&item.Category,
-			&item.Description,
-			&item.IsAvailable,
-			&item.Price,
-			&item.ImagePath,
-			&item.CreatedAt,
-		)
-		if err != nil {
+		if err := scanItem(rows, &item); err != nil {
 			return nil, err
 		}
 		items = append(items, item)
@@ -76,31 +74,61 @@ func (s *ItemService) GetItemsByCategory(category string) ([]models.Item, error)
 	return items, nil
 }
 
-func (s *ItemService) CreateItem(input models.CreateItemInput) (*models.Item, error) {
-	var item models.Item
-	err := config.DB.QueryRow(`
-        INSERT INTO items (name, category, description, price, image_path)
-        VALUES ($1, $2, $3, $4, $5)
-        RETURNING id, name, category, description, is_available, price, image_path, created_at
-    `, input.Name, input.Category, input.Description, input.Price, input.ImagePath).Scan(
-		&item.ID,
-		&item.Name,
-		&item.Category,
-		&item.Description,
-		&item.IsAvailable,
-		&item.Price,
-		&item.ImagePath,
-		&item.CreatedAt,
-	)
+func (s *ItemService) CreateItem(input models.CreateItemInput, actor models.Actor) (*models.Item, error) {
+	if input.StockCount != nil && *input.StockCount < 0 {
+		verr := &ValidationError{}
+		verr.Add("stock_count", "must not be negative")
+		return nil, verr
+	}
+
+	tx, err := config.DB.Begin()
 	if err != nil {
 		return nil, err
 	}
-	return &item, nil
+	defer tx.Rollback()
+
+	var id int
+	err = tx.QueryRow(`
+        INSERT INTO items (name, category, description, price, image_path, stock_count)
+        VALUES ($1, $2, $3, $4, $5, $6)
+        RETURNING id
+    `, input.Name, input.Category, input.Description, input.Price, input.ImagePath, input.StockCount).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	// A limited special created with none left starts out sold out
+	var pending pendingEvents
+	if err := refreshStockAvailability(tx, stockScope{items: []int{id}}, &pending); err != nil {
+		return nil, err
+	}
+	item, err := getItemForUpdate(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordAudit(tx, actor, models.AuditItemCreated, models.AuditEntityItem, item.ID, nil, item)
+	if err != nil {
+		return nil, err
+	}
+	pending.add(events.ItemCreated, *item)
+	if err := pending.commit(tx); err != nil {
+		return nil, err
+	}
+
+	pending.publish()
+	return item, nil
 }
 
-func (s *ItemService) CreatePizzaPrices(input models.CreatePizzaPrice) (*models.PizzaBasePrice, error) {
+func (s *ItemService) CreatePizzaPrices(input models.CreatePizzaPrice, actor models.Actor) (*models.PizzaBasePrice, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	var pizza_price models.PizzaBasePrice
-	err := config.DB.QueryRow(`
+	err = tx.QueryRow(`
         INSERT INTO pizza_base_prices (item_id, size, price)
         VALUES ($1, $2, $3)
         RETURNING id, item_id, size, price, created_at
@@ -114,70 +142,172 @@ func (s *ItemService) CreatePizzaPrices(input models.CreatePizzaPrice) (*models.
 	if err != nil {
 		return nil, err
 	}
+
+	err = recordAudit(tx, actor, models.AuditPizzaPriceCreated, models.AuditEntityItem, pizza_price.ItemID, nil, pizza_price)
+	if err != nil {
+		return nil, err
+	}
+
+	// The new size may be one there is stock to make
+	var pending pendingEvents
+	pending.add(events.PriceChanged, events.PriceChange{
+		ItemID: pizza_price.ItemID,
+		Size:   &pizza_price.Size,
+		Price:  pizza_price.Price,
+	})
+	if err := refreshStockAvailability(tx, stockScope{items: []int{pizza_price.ItemID}}, &pending); err != nil {
+		return nil, err
+	}
+	if err := pending.commit(tx); err != nil {
+		return nil, err
+	}
+
+	pending.publish()
 	return &pizza_price, nil
 }
 
-func (s *ItemService) UpdateItem(id int, input models.UpdateItemInput) (*models.Item, error) {
+// getItemForUpdate loads an item and locks it until tx ends.
+func getItemForUpdate(tx *sql.Tx, id int) (*models.Item, error) {
 	var item models.Item
-	err := config.DB.QueryRow(`
+	err := scanItem(tx.QueryRow(`
+        SELECT `+itemColumns+`
+        FROM items
+        WHERE id = $1
+        FOR UPDATE
+    `, id), &item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (s *ItemService) UpdateItem(id int, input models.UpdateItemInput, actor models.Actor) (*models.Item, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := getItemForUpdate(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Setting is_available by hand clears sold_out; stock is checked again
+	// below, so an item still short of stock is sold out again
+	_, err = tx.Exec(`
         UPDATE items 
         SET 
             name = COALESCE($1, name),
             description = COALESCE($2, description),
             is_available = COALESCE($3, is_available),
+            sold_out = sold_out AND $3::boolean IS NULL,
             price = COALESCE($4, price),
-            image_path = COALESCE($5, image_path)
-        WHERE id = $6
-        RETURNING id, name, category, description, is_available, price, image_path, created_at
-    `, input.Name, input.Description, input.IsAvailable, input.Price, input.ImagePath, id).Scan(
-		&item.ID,
-		&item.Name,
-		&item.Category,
-		&item.Description,
-		&item.IsAvailable,
-		&item.Price,
-		&item.ImagePath,
-		&item.CreatedAt,
-	)
+            image_path = COALESCE($5, image_path),
+            stock_count = CASE WHEN $6::int IS NULL THEN stock_count WHEN $6 < 0 THEN NULL ELSE $6 END
+        WHERE id = $7
+    `, input.Name, input.Description, input.IsAvailable, input.Price, input.ImagePath, input.StockCount, id)
 	if err != nil {
 		return nil, err
 	}
-	return &item, nil
+
+	var pending pendingEvents
+	if err := refreshStockAvailability(tx, stockScope{items: []int{id}}, &pending); err != nil {
+		return nil, err
+	}
+	item, err := getItemForUpdate(tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordAudit(tx, actor, models.AuditItemUpdated, models.AuditEntityItem, id, before, item)
+	if err != nil {
+		return nil, err
+	}
+	pending.add(events.ItemUpdated, *item)
+	if input.Price != nil && item.Price != nil {
+		pending.add(events.PriceChanged, events.PriceChange{ItemID: item.ID, Price: *item.Price})
+	}
+	if err := pending.commit(tx); err != nil {
+		return nil, err
+	}
+
+	pending.publish()
+	return item, nil
+}
+
+// deletedItem is what the audit log keeps of a deleted item.
+type deletedItem struct {
+	models.Item
+	Prices map[string]models.Money `json:"prices,omitempty"`
+	Recipe []models.RecipeLine     `json:"recipe,omitempty"`
 }
 
-func (s *ItemService) DeleteItem(id int) error {
+func (s *ItemService) DeleteItem(id int, actor models.Actor) error {
 	// Start a transaction
 	tx, err := config.DB.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	// First check if the item exists
-	var exists bool
-	err = config.DB.QueryRow("SELECT EXISTS(SELECT 1 FROM items WHERE id = $1)", id).Scan(&exists)
+	// First check if the item exists, keeping a copy for the audit log
+	item, err := getItemForUpdate(tx, id)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return sql.ErrNoRows
-	}
+	before := deletedItem{Item: *item}
 
 	// Delete from pizza_base_prices first (if any)
-	_, err = tx.Exec("DELETE FROM pizza_base_prices WHERE item_id = $1", id)
+	rows, err := tx.Query("DELETE FROM pizza_base_prices WHERE item_id = $1 RETURNING size, price", id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			size  string
+			price models.Money
+		)
+		if err := rows.Scan(&size, &price); err != nil {
+			return err
+		}
+		if before.Prices == nil {
+			before.Prices = make(map[string]models.Money)
+		}
+		before.Prices[size] = price
+	}
+	rows.Close()
+
+	// And its recipe
+	before.Recipe, err = getItemRecipe(tx, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM item_recipes WHERE item_id = $1", id)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
 	// Then delete the item
 	_, err = tx.Exec("DELETE FROM items WHERE id = $1", id)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
-	// Commit the transaction
-	return tx.Commit()
+	err = recordAudit(tx, actor, models.AuditItemDeleted, models.AuditEntityItem, id, before, nil)
+	if err != nil {
+		return err
+	}
+
+	var pending pendingEvents
+	pending.add(events.ItemDeleted, events.ItemRef{ItemID: id})
+	if err := pending.commit(tx); err != nil {
+		return err
+	}
+
+	pending.publish()
+	return nil
 }
 
 func (s *ItemService) GetPizzasWithPrices() ([]models.PizzaWithPrices, error) {
@@ -207,7 +337,7 @@ func (s *ItemService) GetPizzasWithPrices() ([]models.PizzaWithPrices, error) {
 			imagePath   string
 			createdAt   time.Time
 			size        string
-			price       float64
+			price       models.Money
 		)
 
 		err := rows.Scan(&id, &name, &category, &description, &isAvailable, &imagePath, &createdAt, &size, &price)
@@ -226,7 +356,7 @@ func (s *ItemService) GetPizzasWithPrices() ([]models.PizzaWithPrices, error) {
 					ImagePath:   imagePath,
 					CreatedAt:   createdAt,
 				},
-				Prices: make(map[string]float64),
+				Prices: make(map[string]models.Money),
 			}
 		}
 
@@ -245,7 +375,7 @@ func (s *ItemService) GetToppings() ([]models.Topping, error) {
 	var toppings []models.Topping
 
 	rows, err := config.DB.Query(`
-        SELECT id, name, price, is_available, created_at 
+        SELECT id, name, price, is_available, sold_out, created_at 
         FROM toppings
         WHERE is_available = true
         ORDER BY name
@@ -262,6 +392,7 @@ func (s *ItemService) GetToppings() ([]models.Topping, error) {
 			&topping.Name,
 			&topping.Price,
 			&topping.IsAvailable,
+			&topping.SoldOut,
 			&topping.CreatedAt,
 		)
 		if err != nil {
@@ -273,31 +404,58 @@ func (s *ItemService) GetToppings() ([]models.Topping, error) {
 	return toppings, nil
 }
 
-func (s *ItemService) UpdatePizzaPrices(itemID int, input models.UpdatePizzaPrice) error {
-	result, err := config.DB.Exec(`
+func (s *ItemService) UpdatePizzaPrices(itemID int, input models.UpdatePizzaPrice, actor models.Actor) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var before models.PizzaBasePrice
+	err = tx.QueryRow(`
+        SELECT id, item_id, size, price, created_at
+        FROM pizza_base_prices
+        WHERE item_id = $1 AND size = $2
+        FOR UPDATE
+    `, itemID, input.Size).Scan(
+		&before.ID,
+		&before.ItemID,
+		&before.Size,
+		&before.Price,
+		&before.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
         UPDATE pizza_base_prices 
         SET price = $1
-        WHERE item_id = $2 AND size = $3
-    `, input.Price, itemID, input.Size)
-
+        WHERE id = $2
+    `, input.Price, before.ID)
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	after := before
+	after.Price = input.Price
+	err = recordAudit(tx, actor, models.AuditPizzaPriceUpdated, models.AuditEntityItem, itemID, before, after)
 	if err != nil {
 		return err
 	}
-
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	var pending pendingEvents
+	size := input.Size
+	pending.add(events.PriceChanged, events.PriceChange{ItemID: itemID, Size: &size, Price: input.Price})
+	if err := pending.commit(tx); err != nil {
+		return err
 	}
 
+	pending.publish()
 	return nil
 }
 
-func (s *ItemService) GetPizzaPricesById(id int) (map[string]float64, error) {
-	prices := make(map[string]float64)
+func (s *ItemService) GetPizzaPricesById(id int) (map[string]models.Money, error) {
+	prices := make(map[string]models.Money)
 
 	rows, err := config.DB.Query(`
         SELECT size, price 
@@ -311,7 +469,7 @@ func (s *ItemService) GetPizzaPricesById(id int) (map[string]float64, error) {
 
 	for rows.Next() {
 		var size string
-		var price float64
+		var price models.Money
 
 		if err := rows.Scan(&size, &price); err != nil {
 			return nil, err
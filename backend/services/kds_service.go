@@ -0,0 +1,239 @@
+package services
+
+import (
+	"database/sql"
+	"log"
+	"pizza-shop/config"
+	"pizza-shop/events"
+	"pizza-shop/models"
+)
+
+type KDSService struct{}
+
+// createKitchenTickets splits a new invoice's items across the kitchen
+// stations that prepare them. categories[i] is the category of items[i].
+func createKitchenTickets(tx *sql.Tx, invoiceID int, items []models.InvoiceItem, categories []string) error {
+	tickets := make(map[string]int)
+	for i, item := range items {
+		station, ok := config.KitchenStations[categories[i]]
+		if !ok {
+			continue
+		}
+
+		ticketID, ok := tickets[station]
+		if !ok {
+			err := tx.QueryRow(`
+				INSERT INTO kds_tickets (invoice_id, station) VALUES ($1, $2) RETURNING id
+			`, invoiceID, station).Scan(&ticketID)
+			if err != nil {
+				return err
+			}
+			tickets[station] = ticketID
+		}
+
+		_, err := tx.Exec(`
+			INSERT INTO kds_ticket_items (ticket_id, invoice_item_id) VALUES ($1, $2)
+		`, ticketID, item.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadTickets fetches tickets with their items. where filters on the
+// kds_tickets (t) and invoices (i) tables.
+func loadTickets(db querier, where string, args ...interface{}) ([]models.KDSTicket, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.invoice_id, i.order_no, i.status, t.station, t.status, t.created_at, t.ready_at,
+		       EXTRACT(EPOCH FROM COALESCE(t.ready_at, LOCALTIMESTAMP) - t.created_at)::int,
+		       ti.id, ti.invoice_item_id, ii.item_name, ii.size, ii.quantity, ti.ready_at
+		FROM kds_tickets t
+		JOIN invoices i ON i.id = t.invoice_id
+		JOIN kds_ticket_items ti ON ti.ticket_id = t.id
+		JOIN invoice_items ii ON ii.id = ti.invoice_item_id
+		WHERE `+where+`
+		ORDER BY t.created_at, t.id, ti.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tickets := []models.KDSTicket{}
+	var invoiceItemIDs []int64
+	for rows.Next() {
+		var ticket models.KDSTicket
+		var item models.KDSTicketItem
+		err := rows.Scan(
+			&ticket.ID,
+			&ticket.InvoiceID,
+			&ticket.OrderNo,
+			&ticket.InvoiceStatus,
+			&ticket.Station,
+			&ticket.Status,
+			&ticket.CreatedAt,
+			&ticket.ReadyAt,
+			&ticket.ElapsedSeconds,
+			&item.ID,
+			&item.InvoiceItemID,
+			&item.ItemName,
+			&item.Size,
+			&item.Quantity,
+			&item.ReadyAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(tickets) == 0 || tickets[len(tickets)-1].ID != ticket.ID {
+			tickets = append(tickets, ticket)
+		}
+		last := &tickets[len(tickets)-1]
+		last.Items = append(last.Items, item)
+		invoiceItemIDs = append(invoiceItemIDs, int64(item.InvoiceItemID))
+	}
+	rows.Close()
+
+	toppings, err := getToppingsForItems(invoiceItemIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tickets {
+		for j := range tickets[i].Items {
+			item := &tickets[i].Items[j]
+			item.Toppings = toppings[item.InvoiceItemID]
+		}
+	}
+
+	return tickets, nil
+}
+
+// GetTickets lists a station's tickets, or every station's if station is
+// empty. status is open or ready; tickets for cancelled orders are left out.
+func (s *KDSService) GetTickets(station, status string) ([]models.KDSTicket, error) {
+	if status != models.KDSTicketOpen && status != models.KDSTicketReady {
+		verr := &ValidationError{}
+		verr.Add("status", "must be %s or %s", models.KDSTicketOpen, models.KDSTicketReady)
+		return nil, verr
+	}
+
+	return loadTickets(config.DB, `
+		($1 = '' OR t.station = $1) AND t.status = $2 AND i.status NOT IN ('voided', 'refunded')
+	`, station, status)
+}
+
+func (s *KDSService) GetTicket(id int) (*models.KDSTicket, error) {
+	tickets, err := loadTickets(config.DB, "t.id = $1", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(tickets) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &tickets[0], nil
+}
+
+// BumpItem marks one item on a ticket as ready. The ticket is ready once all
+// of its items are.
+func (s *KDSService) BumpItem(ticketItemID int, actor models.Actor) (*models.KDSTicket, error) {
+	var ticketID int
+	err := config.DB.QueryRow(`
+		SELECT ticket_id FROM kds_ticket_items WHERE id = $1
+	`, ticketItemID).Scan(&ticketID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.bump(ticketID, actor, "id = $2", ticketItemID)
+}
+
+// BumpTicket marks every item on a ticket as ready.
+func (s *KDSService) BumpTicket(ticketID int, actor models.Actor) (*models.KDSTicket, error) {
+	return s.bump(ticketID, actor, "TRUE")
+}
+
+// bump marks the ticket's items matching where as ready and moves the order
+// along: to preparing when the kitchen starts on it and to ready once every
+// station has finished.
+func (s *KDSService) bump(ticketID int, actor models.Actor, where string, args ...interface{}) (*models.KDSTicket, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var invoiceID int
+	err = tx.QueryRow(`SELECT invoice_id FROM kds_tickets WHERE id = $1`, ticketID).Scan(&invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := lockInvoiceStatus(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if status == models.InvoiceStatusVoided || status == models.InvoiceStatusRefunded {
+		return nil, &ConflictError{Message: "order has been " + status}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE kds_ticket_items SET ready_at = CURRENT_TIMESTAMP
+		WHERE ticket_id = $1 AND ready_at IS NULL AND `+where,
+		append([]interface{}{ticketID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE kds_tickets SET status = 'ready', ready_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = 'open'
+		  AND NOT EXISTS (SELECT 1 FROM kds_ticket_items WHERE ticket_id = $1 AND ready_at IS NULL)
+	`, ticketID)
+	if err != nil {
+		return nil, err
+	}
+
+	var allReady bool
+	err = tx.QueryRow(`
+		SELECT NOT EXISTS (SELECT 1 FROM kds_tickets WHERE invoice_id = $1 AND status = 'open')
+	`, invoiceID).Scan(&allReady)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending pendingEvents
+	if status == models.InvoiceStatusOpen {
+		if err := changeStatus(tx, invoiceID, models.InvoiceStatusPreparing, &pending, actor); err != nil {
+			return nil, err
+		}
+		status = models.InvoiceStatusPreparing
+	}
+	if allReady && status == models.InvoiceStatusPreparing {
+		if err := changeStatus(tx, invoiceID, models.InvoiceStatusReady, &pending, actor); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := pending.commit(tx); err != nil {
+		return nil, err
+	}
+
+	pending.publish()
+	publishInvoiceTickets(invoiceID)
+	return s.GetTicket(ticketID)
+}
+
+// publishInvoiceTickets announces the invoice's current tickets to kitchen
+// screens.
+func publishInvoiceTickets(invoiceID int) {
+	tickets, err := loadTickets(config.DB, "t.invoice_id = $1", invoiceID)
+	if err != nil {
+		log.Printf("Failed to load kitchen tickets for invoice %d: %v", invoiceID, err)
+		return
+	}
+
+	for _, ticket := range tickets {
+		events.Publish(events.KitchenTicketChanged, ticket)
+	}
+}
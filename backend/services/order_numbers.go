@@ -0,0 +1,82 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"pizza-shop/config"
+	"time"
+	"unicode/utf8"
+)
+
+// orderCounter returns the counter key and number prefix for orders placed
+// at the given time. Daily counters get the date in both, so a reset never
+// produces a number that was already issued.
+func orderCounter(now time.Time) (key, prefix string) {
+	settings := config.OrderNumbers
+	key = settings.Branch
+	prefix = settings.Prefix
+	if settings.DailyReset {
+		key += "/" + now.Format("2006-01-02")
+		prefix += now.Format("060102") + "-"
+	}
+	return key, prefix
+}
+
+// allocateOrderNo reserves the next order number inside tx. The counter row
+// stays locked until tx ends, so concurrent tills can never get the same
+// number. A new counter starts after the highest number already issued with
+// its prefix, and numbers that are somehow taken already are skipped, so a
+// database with existing invoices can't wedge order taking.
+func allocateOrderNo(tx *sql.Tx, now time.Time) (string, error) {
+	key, prefix := orderCounter(now)
+
+	for {
+		var next int
+		err := tx.QueryRow(`
+			UPDATE order_counters SET last_value = last_value + 1
+			WHERE counter_key = $1
+			RETURNING last_value
+		`, key).Scan(&next)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRow(`
+				INSERT INTO order_counters (counter_key, last_value)
+				SELECT $1, GREATEST($2, COALESCE(MAX(substr(order_no, $4)::int) + 1, 0))
+				FROM invoices
+				WHERE starts_with(order_no, $3) AND substr(order_no, $4) ~ '^[0-9]{1,9}$'
+				ON CONFLICT (counter_key) DO UPDATE SET last_value = order_counters.last_value + 1
+				RETURNING last_value
+			`, key, config.OrderNumbers.Start, prefix, utf8.RuneCountInString(prefix)+1).Scan(&next)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		orderNo := fmt.Sprintf("%s%d", prefix, next)
+		var taken bool
+		err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM invoices WHERE order_no = $1)`, orderNo).Scan(&taken)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return orderNo, nil
+		}
+	}
+}
+
+// peekOrderNo returns the number the next order will most likely get,
+// without reserving it.
+func peekOrderNo(now time.Time) (string, error) {
+	key, prefix := orderCounter(now)
+
+	var next int
+	err := config.DB.QueryRow(`
+		SELECT COALESCE(MAX(last_value) + 1, $2)
+		FROM order_counters
+		WHERE counter_key = $1
+	`, key, config.OrderNumbers.Start).Scan(&next)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s%d", prefix, next), nil
+}
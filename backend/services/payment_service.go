@@ -0,0 +1,209 @@
+package services
+
+import (
+	"fmt"
+	"pizza-shop/config"
+	"pizza-shop/models"
+	"sort"
+)
+
+var paymentMethods = map[string]bool{
+	models.PaymentCash:    true,
+	models.PaymentCard:    true,
+	models.PaymentVoucher: true,
+}
+
+// invoiceBalance is what an invoice owes at a point in time.
+type invoiceBalance struct {
+	Due  models.Money // TotalAmount + TaxAmount less voids and refunds
+	Paid models.Money // Payments less the money refunded
+}
+
+func (b invoiceBalance) Outstanding() models.Money {
+	if b.Paid >= b.Due {
+		return 0
+	}
+	return b.Due - b.Paid
+}
+
+func getInvoiceBalance(db querier, invoiceID int) (invoiceBalance, error) {
+	var balance invoiceBalance
+	err := db.QueryRow(`
+		SELECT i.total_amount + i.tax_amount
+		       - COALESCE((SELECT SUM(amount + tax_amount) FROM credit_notes WHERE invoice_id = i.id), 0),
+		       COALESCE((SELECT SUM(amount) FROM payments WHERE invoice_id = i.id), 0)
+		       - COALESCE((SELECT SUM(refund_amount) FROM credit_notes WHERE invoice_id = i.id), 0)
+		FROM invoices i
+		WHERE i.id = $1
+	`, invoiceID).Scan(&balance.Due, &balance.Paid)
+	return balance, err
+}
+
+// RecordPayment applies one or more tenders to an invoice. Card and voucher
+// tenders may not exceed the balance; cash is applied last and any excess
+// is returned as change. The invoice is marked paid once the tenders cover
+// the amount due.
+func (s *InvoiceService) RecordPayment(invoiceID int, input models.CreatePaymentInput, actor models.Actor) (*models.Invoice, error) {
+	verr := &ValidationError{}
+	if len(input.Tenders) == 0 {
+		verr.Add("tenders", "at least one tender is required")
+	}
+	for i, tender := range input.Tenders {
+		field := fmt.Sprintf("tenders[%d]", i)
+		if !paymentMethods[tender.Method] {
+			verr.Add(field+".method", "must be cash, card or voucher")
+		}
+		if tender.Amount <= 0 {
+			verr.Add(field+".amount", "must be greater than zero")
+		}
+	}
+	if verr.HasProblems() {
+		return nil, verr
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	status, err := lockInvoiceStatus(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	if status == models.InvoiceStatusVoided || status == models.InvoiceStatusRefunded {
+		return nil, &ConflictError{Message: fmt.Sprintf("cannot take payment for a %s invoice", status)}
+	}
+
+	balance, err := getInvoiceBalance(tx, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	outstanding := balance.Outstanding()
+	if outstanding == 0 {
+		return nil, &ConflictError{Message: "invoice is already paid"}
+	}
+
+	// Cash goes into the drawer of the till it's taken on, which must be
+	// open. The drawer stays locked until the payment is committed so it
+	// can't be counted in the meantime.
+	for _, tender := range input.Tenders {
+		if tender.Method == models.PaymentCash {
+			if input.TillSessionID == nil {
+				return nil, &ConflictError{Message: "cash can only be taken on a till with an open cash drawer"}
+			}
+			if _, err := lockOpenCashDrawer(tx, *input.TillSessionID); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+
+	// Apply exact tenders before cash so change is worked out on what's
+	// left after them. Problems are reported against the order the
+	// tenders were sent in.
+	order := make([]int, len(input.Tenders))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return input.Tenders[order[a]].Method != models.PaymentCash && input.Tenders[order[b]].Method == models.PaymentCash
+	})
+
+	var payments []models.Payment
+	for _, i := range order {
+		tender := input.Tenders[i]
+		if outstanding == 0 {
+			verr.Add(fmt.Sprintf("tenders[%d]", i), "invoice is already covered by the other tenders")
+			continue
+		}
+
+		payment := models.Payment{
+			InvoiceID:     invoiceID,
+			Method:        tender.Method,
+			Amount:        tender.Amount,
+			Tendered:      tender.Amount,
+			Reference:     tender.Reference,
+			TillSessionID: input.TillSessionID,
+		}
+		if tender.Amount > outstanding {
+			if tender.Method != models.PaymentCash {
+				verr.Add(fmt.Sprintf("tenders[%d].amount", i), "%s payments cannot exceed the balance of %s", tender.Method, outstanding)
+				continue
+			}
+			payment.Amount = outstanding
+			payment.Change = tender.Amount - outstanding
+		}
+		outstanding -= payment.Amount
+
+		err = tx.QueryRow(`
+			INSERT INTO payments (invoice_id, method, amount, tendered, change_given, reference, till_session_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id, created_at
+		`, invoiceID, payment.Method, payment.Amount, payment.Tendered, payment.Change,
+			payment.Reference, payment.TillSessionID).Scan(&payment.ID, &payment.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+	if verr.HasProblems() {
+		return nil, verr
+	}
+
+	if outstanding == 0 {
+		_, err = tx.Exec(`UPDATE invoices SET paid_at = CURRENT_TIMESTAMP WHERE id = $1`, invoiceID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = recordAudit(tx, actor, models.AuditPaymentRecorded, models.AuditEntityInvoice, invoiceID,
+		map[string]models.Money{"balance_due": balance.Outstanding()},
+		map[string]interface{}{"payments": payments, "balance_due": outstanding})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return s.getInvoiceHeader(invoiceID)
+}
+
+func getPayments(invoiceID int) ([]models.Payment, error) {
+	rows, err := config.DB.Query(`
+		SELECT id, invoice_id, method, amount, tendered, change_given, COALESCE(reference, ''), created_at,
+		       till_session_id
+		FROM payments
+		WHERE invoice_id = $1
+		ORDER BY id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var payments []models.Payment
+	for rows.Next() {
+		var payment models.Payment
+		err := rows.Scan(
+			&payment.ID,
+			&payment.InvoiceID,
+			&payment.Method,
+			&payment.Amount,
+			&payment.Tendered,
+			&payment.Change,
+			&payment.Reference,
+			&payment.CreatedAt,
+			&payment.TillSessionID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, payment)
+	}
+
+	return payments, nil
+}
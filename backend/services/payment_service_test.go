@@ -0,0 +1,47 @@
+package services
+
+import (
+	"errors"
+	"pizza-shop/models"
+	"testing"
+)
+
+// TestTenderErrorsUseSentOrder overpays by card alongside cash. Cash is
+// applied last, but the problem must still name the card where the client
+// put it.
+func TestTenderErrorsUseSentOrder(t *testing.T) {
+	db := useTestDB(t)
+	order := createTestOrder(t, db, 1, 0) // 13.20 due
+
+	staffID := testInsert(t, db, `
+		INSERT INTO staff (username, name, role, password_hash)
+		VALUES ('test-cashier-' || $1, 'Test cashier', 'cashier', 'x') RETURNING id
+	`, order.invoiceID)
+	terminalID := testInsert(t, db, `INSERT INTO terminals (name) VALUES ('Test till ' || $1) RETURNING id`, order.invoiceID)
+	sessionID := testInsert(t, db, `
+		INSERT INTO till_sessions (terminal_id, staff_id) VALUES ($1, $2) RETURNING id
+	`, terminalID, staffID)
+	testExec(t, db, `INSERT INTO cash_drawers (till_session_id, opening_float) VALUES ($1, 100)`, sessionID)
+	t.Cleanup(func() {
+		testExec(t, db, `DELETE FROM cash_drawers WHERE till_session_id = $1`, sessionID)
+		testExec(t, db, `DELETE FROM till_sessions WHERE id = $1`, sessionID)
+		testExec(t, db, `DELETE FROM terminals WHERE id = $1`, terminalID)
+		testExec(t, db, `DELETE FROM staff WHERE id = $1`, staffID)
+	})
+
+	_, err := (&InvoiceService{}).RecordPayment(order.invoiceID, models.CreatePaymentInput{
+		Tenders: []models.TenderInput{
+			{Method: models.PaymentCash, Amount: 500},
+			{Method: models.PaymentCard, Amount: 2000},
+		},
+		TillSessionID: &sessionID,
+	}, models.SystemActor)
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("got %v, want a validation error", err)
+	}
+	if len(verr.Problems) != 1 || verr.Problems[0].Field != "tenders[1].amount" {
+		t.Errorf("problems = %+v, want one on tenders[1].amount", verr.Problems)
+	}
+}
@@ -0,0 +1,43 @@
+package services
+
+import (
+	"database/sql"
+	"pizza-shop/events"
+	"time"
+)
+
+// pendingEvents holds events raised inside a transaction until it commits,
+// so subscribers never hear about changes that were rolled back.
+type pendingEvents []pendingEvent
+
+type pendingEvent struct {
+	eventType string
+	data      interface{}
+	time      time.Time
+}
+
+func (p *pendingEvents) add(eventType string, data interface{}) {
+	*p = append(*p, pendingEvent{eventType: eventType, data: data, time: time.Now()})
+}
+
+// commit queues webhook deliveries for the events in tx and commits it, so
+// the deliveries are saved exactly when the change is. Call publish once
+// it succeeds.
+func (p pendingEvents) commit(tx *sql.Tx) error {
+	for _, event := range p {
+		if err := queueWebhookEvent(tx, event); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// publish sends the events once the transaction has committed.
+func (p pendingEvents) publish() {
+	for _, event := range p {
+		events.Publish(event.eventType, event.data)
+	}
+	if len(p) > 0 {
+		wakeWebhookWorkers()
+	}
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"pizza-shop/config"
+	"pizza-shop/models"
+	"pizza-shop/receipt"
+	"strings"
+	"sync"
+	"time"
+)
+
+type PrintService struct{}
+
+const (
+	maxPrintJobs     = 200 // Finished jobs kept for GetPrintJobs
+	printQueueLength = 100
+	printTimeout     = 10 * time.Second
+	maxPrintBackoff  = 30 * time.Second
+)
+
+// printBackoff is the wait after a job's first failed attempt; it doubles
+// with each attempt after that.
+var printBackoff = time.Second
+
+// printJob is a job together with the bytes to send to the printer.
+type printJob struct {
+	models.PrintJob
+	data []byte
+}
+
+// printQueue runs one worker per printer, so a printer that is offline
+// doesn't hold up jobs for the others.
+type printQueue struct {
+	mu      sync.Mutex
+	nextID  int
+	jobs    []*printJob
+	workers map[string]chan *printJob
+}
+
+var printJobs = &printQueue{workers: make(map[string]chan *printJob)}
+
+func (q *printQueue) add(job *printJob) error {
+	q.mu.Lock()
+	q.nextID++
+	job.ID = q.nextID
+	q.jobs = append(q.jobs, job)
+	q.trim()
+	q.mu.Unlock()
+
+	return q.enqueue(job)
+}
+
+// trim drops the oldest finished jobs once there are more than maxPrintJobs.
+func (q *printQueue) trim() {
+	kept := q.jobs[:0]
+	excess := len(q.jobs) - maxPrintJobs
+	for _, job := range q.jobs {
+		if excess > 0 && job.Status != models.PrintJobQueued {
+			excess--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	q.jobs = kept
+}
+
+// enqueue hands the job to its printer's worker. It never waits: if the
+// printer already has printQueueLength jobs waiting, the job fails at once
+// with ErrPrintQueueFull and can be retried later.
+func (q *printQueue) enqueue(job *printJob) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queue, ok := q.workers[job.Printer]
+	if !ok {
+		queue = make(chan *printJob, printQueueLength)
+		q.workers[job.Printer] = queue
+		go q.work(queue)
+	}
+
+	select {
+	case queue <- job:
+		return nil
+	default:
+		job.Status = models.PrintJobFailed
+		job.LastError = ErrPrintQueueFull.Error()
+		return ErrPrintQueueFull
+	}
+}
+
+func (q *printQueue) work(queue chan *printJob) {
+	for job := range queue {
+		q.print(job)
+	}
+}
+
+// print sends a job to its printer, backing off between attempts until it
+// succeeds or runs out of attempts.
+func (q *printQueue) print(job *printJob) {
+	backoff := printBackoff
+	for {
+		err := sendToPrinter(job.Printer, job.data)
+
+		q.mu.Lock()
+		job.Attempts++
+		if err == nil {
+			now := time.Now()
+			job.Status = models.PrintJobPrinted
+			job.PrintedAt = &now
+			job.LastError = ""
+		} else {
+			job.LastError = err.Error()
+			if job.Attempts >= config.PrintAttempts {
+				job.Status = models.PrintJobFailed
+			}
+		}
+		status := job.Status
+		q.mu.Unlock()
+
+		if status != models.PrintJobQueued {
+			if status == models.PrintJobFailed {
+				log.Printf("Print job %d to %s failed: %v", job.ID, job.Printer, err)
+			}
+			return
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxPrintBackoff {
+			backoff = maxPrintBackoff
+		}
+	}
+}
+
+// sendToPrinter writes data to a network printer (tcp://host:port, usually
+// port 9100) or appends it to a file or device such as /dev/usb/lp0.
+func sendToPrinter(address string, data []byte) error {
+	if strings.HasPrefix(address, "tcp://") {
+		conn, err := net.DialTimeout("tcp", strings.TrimPrefix(address, "tcp://"), printTimeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		if err := conn.SetDeadline(time.Now().Add(printTimeout)); err != nil {
+			return err
+		}
+		_, err = conn.Write(data)
+		return err
+	}
+
+	file, err := os.OpenFile(address, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// PrintInvoice queues a receipt or kitchen ticket for the invoice on the
+// target's printer. The job is printed in the background; if the printer's
+// queue is already full it fails straight away with ErrPrintQueueFull.
+func (s *PrintService) PrintInvoice(invoiceID int, target string) (*models.PrintJob, error) {
+	if target != models.PrintTargetReceipt && target != models.PrintTargetKitchen {
+		verr := &ValidationError{}
+		verr.Add("target", "must be %s or %s", models.PrintTargetReceipt, models.PrintTargetKitchen)
+		return nil, verr
+	}
+	printer, ok := config.Printers[target]
+	if !ok {
+		return nil, &ConflictError{Message: fmt.Sprintf("no %s printer is configured", target)}
+	}
+
+	invoiceService := InvoiceService{}
+	invoice, err := invoiceService.GetInvoice(invoiceID)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := receipt.Receipt(invoice, receipt.ESCPOSWidth)
+	if target == models.PrintTargetKitchen {
+		lines = receipt.KitchenTicket(invoice, receipt.ESCPOSWidth)
+	}
+	var data bytes.Buffer
+	if err := receipt.WriteESCPOS(&data, lines); err != nil {
+		return nil, err
+	}
+
+	job := &printJob{
+		PrintJob: models.PrintJob{
+			InvoiceID: invoice.ID,
+			OrderNo:   invoice.OrderNo,
+			Target:    target,
+			Printer:   printer,
+			Status:    models.PrintJobQueued,
+			CreatedAt: time.Now(),
+		},
+		data: data.Bytes(),
+	}
+	if err := printJobs.add(job); err != nil {
+		return nil, err
+	}
+
+	return s.GetPrintJob(job.ID)
+}
+
+// GetPrintJobs lists recent print jobs, newest first.
+func (s *PrintService) GetPrintJobs() []models.PrintJob {
+	printJobs.mu.Lock()
+	defer printJobs.mu.Unlock()
+
+	jobs := make([]models.PrintJob, 0, len(printJobs.jobs))
+	for i := len(printJobs.jobs) - 1; i >= 0; i-- {
+		jobs = append(jobs, printJobs.jobs[i].PrintJob)
+	}
+	return jobs
+}
+
+func (s *PrintService) GetPrintJob(id int) (*models.PrintJob, error) {
+	printJobs.mu.Lock()
+	defer printJobs.mu.Unlock()
+
+	for _, job := range printJobs.jobs {
+		if job.ID == id {
+			snapshot := job.PrintJob
+			return &snapshot, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+// RetryPrintJob queues a failed job again, e.g. once the printer has been
+// switched back on.
+func (s *PrintService) RetryPrintJob(id int) (*models.PrintJob, error) {
+	printJobs.mu.Lock()
+	var job *printJob
+	for _, candidate := range printJobs.jobs {
+		if candidate.ID == id {
+			job = candidate
+		}
+	}
+	if job == nil {
+		printJobs.mu.Unlock()
+		return nil, sql.ErrNoRows
+	}
+	if job.Status != models.PrintJobFailed {
+		printJobs.mu.Unlock()
+		return nil, &ConflictError{Message: fmt.Sprintf("print job %d is %s", id, job.Status)}
+	}
+	job.Status = models.PrintJobQueued
+	job.Attempts = 0
+	printJobs.mu.Unlock()
+
+	if err := printJobs.enqueue(job); err != nil {
+		return nil, err
+	}
+	return s.GetPrintJob(id)
+}
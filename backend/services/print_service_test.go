@@ -0,0 +1,213 @@
+package services
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"pizza-shop/config"
+	"pizza-shop/models"
+	"testing"
+	"time"
+)
+
+// fakePrinter accepts connections like a network printer on port 9100 and
+// passes on everything sent to it.
+type fakePrinter struct {
+	listener net.Listener
+	received chan []byte
+}
+
+func listenPrinter(t *testing.T, address string) *fakePrinter {
+	t.Helper()
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printer := &fakePrinter{listener: listener, received: make(chan []byte, 10)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			data, _ := io.ReadAll(conn)
+			conn.Close()
+			printer.received <- data
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+	return printer
+}
+
+func (p *fakePrinter) address() string {
+	return "tcp://" + p.listener.Addr().String()
+}
+
+// offlineAddress returns the address of a port nothing is listening on.
+func offlineAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+// usePrintQueue swaps in an empty print queue that retries quickly.
+func usePrintQueue(t *testing.T, attempts int) *printQueue {
+	t.Helper()
+	queue := &printQueue{workers: make(map[string]chan *printJob)}
+
+	previousQueue, previousBackoff, previousAttempts := printJobs, printBackoff, config.PrintAttempts
+	printJobs, printBackoff, config.PrintAttempts = queue, 10*time.Millisecond, attempts
+	t.Cleanup(func() {
+		printJobs, printBackoff, config.PrintAttempts = previousQueue, previousBackoff, previousAttempts
+	})
+	return queue
+}
+
+func newPrintJob(printer string, data string) *printJob {
+	return &printJob{
+		PrintJob: models.PrintJob{
+			InvoiceID: 1,
+			OrderNo:   "0001",
+			Target:    models.PrintTargetReceipt,
+			Printer:   printer,
+			Status:    models.PrintJobQueued,
+			CreatedAt: time.Now(),
+		},
+		data: []byte(data),
+	}
+}
+
+// waitForPrintJob waits until the job leaves the queued status.
+func waitForPrintJob(t *testing.T, id int) models.PrintJob {
+	t.Helper()
+	service := &PrintService{}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := service.GetPrintJob(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != models.PrintJobQueued {
+			return *job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("print job %d still queued after %d attempts", id, job.Attempts)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPrintJobDelivered(t *testing.T) {
+	queue := usePrintQueue(t, 3)
+	printer := listenPrinter(t, "127.0.0.1:0")
+
+	job := newPrintJob(printer.address(), "\x1b@Order 0001\n")
+	if err := queue.add(job); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case data := <-printer.received:
+		if !bytes.Equal(data, job.data) {
+			t.Errorf("printer got %q, want %q", data, job.data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was printed")
+	}
+
+	done := waitForPrintJob(t, job.ID)
+	if done.Status != models.PrintJobPrinted || done.Attempts != 1 || done.PrintedAt == nil {
+		t.Errorf("job is %s after %d attempts, want printed after 1", done.Status, done.Attempts)
+	}
+}
+
+func TestPrintJobOfflineThenRetried(t *testing.T) {
+	queue := usePrintQueue(t, 3)
+	address := offlineAddress(t)
+
+	job := newPrintJob("tcp://"+address, "Order 0002\n")
+	if err := queue.add(job); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := waitForPrintJob(t, job.ID)
+	if failed.Status != models.PrintJobFailed || failed.Attempts != 3 || failed.LastError == "" {
+		t.Fatalf("job is %s after %d attempts (%q), want failed after 3 with an error",
+			failed.Status, failed.Attempts, failed.LastError)
+	}
+
+	// The printer comes back on and the job is retried by hand
+	printer := listenPrinter(t, address)
+	service := &PrintService{}
+	retried, err := service.RetryPrintJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried.Attempts != 0 {
+		t.Errorf("retried job has %d attempts, want them reset", retried.Attempts)
+	}
+
+	select {
+	case data := <-printer.received:
+		if string(data) != "Order 0002\n" {
+			t.Errorf("printer got %q", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was printed after the retry")
+	}
+
+	done := waitForPrintJob(t, job.ID)
+	if done.Status != models.PrintJobPrinted || done.LastError != "" {
+		t.Errorf("job is %s (%q), want printed", done.Status, done.LastError)
+	}
+
+	if _, err := service.RetryPrintJob(job.ID); err == nil {
+		t.Error("retrying a printed job succeeded, want a conflict")
+	}
+}
+
+func TestPrintQueueFull(t *testing.T) {
+	queue := usePrintQueue(t, 3)
+
+	// A printer whose worker is stuck on a job, with one space left
+	stuck := make(chan *printJob, 1)
+	queue.workers["tcp://stuck:9100"] = stuck
+
+	first := newPrintJob("tcp://stuck:9100", "first")
+	if err := queue.add(first); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	second := newPrintJob("tcp://stuck:9100", "second")
+	go func() { done <- queue.add(second) }()
+
+	select {
+	case err := <-done:
+		if err != ErrPrintQueueFull {
+			t.Fatalf("got error %v, want ErrPrintQueueFull", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("adding to a full queue blocked")
+	}
+
+	service := &PrintService{}
+	job, err := service.GetPrintJob(second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != models.PrintJobFailed || job.LastError != ErrPrintQueueFull.Error() {
+		t.Errorf("job is %s (%q), want failed with the queue full", job.Status, job.LastError)
+	}
+
+	// Once the printer catches up the job can be retried
+	<-stuck
+	if _, err := service.RetryPrintJob(second.ID); err != nil {
+		t.Errorf("retry after the queue drained: %v", err)
+	}
+}
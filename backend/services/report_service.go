@@ -0,0 +1,291 @@
+package services
+
+import (
+	"encoding/json"
+	"pizza-shop/config"
+	"pizza-shop/models"
+	"time"
+)
+
+type ReportService struct{}
+
+// periodClause restricts rows to a report period by their z_report_id
+// column: the Z report with id $1, or the open period when $1 is NULL.
+// Rows join a period when a Z report closes it rather than by timestamp, so
+// a sale still being committed while a report closes is in the next one.
+func periodClause(column string) string {
+	return "(" + column + " = $1 OR ($1::int IS NULL AND " + column + " IS NULL))"
+}
+
+// buildSalesReport totals everything in the Z report with id reportID, or
+// in the open period when reportID is nil. start and end are when the
+// period began and ended.
+func buildSalesReport(db querier, reportID *int, start *time.Time, end time.Time) (*models.SalesReport, error) {
+	report := models.SalesReport{
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Taxes:       []models.TaxTotal{},
+		Tenders:     []models.TenderTotal{},
+	}
+
+	err := db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(total_amount), 0), COALESCE(SUM(tax_amount), 0)
+		FROM invoices
+		WHERE `+periodClause("z_report_id"), reportID).Scan(&report.OrderCount, &report.GrossSales, &report.Tax)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT it.name, it.inclusive, SUM(it.amount)
+		FROM invoice_taxes it
+		JOIN invoices i ON i.id = it.invoice_id
+		WHERE `+periodClause("i.z_report_id")+`
+		GROUP BY it.name, it.inclusive
+		ORDER BY it.name
+	`, reportID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tax models.TaxTotal
+		if err := rows.Scan(&tax.Name, &tax.Inclusive, &tax.Amount); err != nil {
+			return nil, err
+		}
+		report.Taxes = append(report.Taxes, tax)
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+		SELECT kind, COUNT(*), SUM(amount), SUM(tax_amount)
+		FROM credit_notes
+		WHERE `+periodClause("z_report_id")+`
+		GROUP BY kind
+	`, reportID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			kind   string
+			credit models.CreditTotal
+		)
+		if err := rows.Scan(&kind, &credit.Count, &credit.Amount, &credit.TaxAmount); err != nil {
+			return nil, err
+		}
+		if kind == models.CreditNoteVoid {
+			report.Voids = credit
+		} else {
+			report.Refunds = credit
+		}
+	}
+	rows.Close()
+
+	rows, err = db.Query(`
+		SELECT method, COUNT(*), SUM(amount), SUM(tendered), SUM(change_given)
+		FROM payments
+		WHERE `+periodClause("z_report_id")+`
+		GROUP BY method
+		ORDER BY method
+	`, reportID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tender models.TenderTotal
+		err := rows.Scan(&tender.Method, &tender.Count, &tender.Amount, &tender.Tendered, &tender.Change)
+		if err != nil {
+			return nil, err
+		}
+		report.Tenders = append(report.Tenders, tender)
+	}
+
+	report.CashDrawers, err = loadCashDrawers(db, "d.status = 'closed' AND "+periodClause("d.z_report_id"), reportID)
+	if err != nil {
+		return nil, err
+	}
+	for _, drawer := range report.CashDrawers {
+		report.CashOverShort += *drawer.OverShort
+	}
+	// Drawers opened before the period ended that weren't counted into it:
+	// for the open period those still open, and for a Z report those
+	// closed into a later one or not yet closed at all
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM cash_drawers
+		WHERE opened_at <= $2
+		  AND (z_report_id > $1 OR (z_report_id IS NULL AND ($1::int IS NOT NULL OR status = 'open')))
+	`, reportID, end).Scan(&report.OpenCashDrawers)
+	if err != nil {
+		return nil, err
+	}
+
+	report.NetSales = report.GrossSales - report.Voids.Amount - report.Refunds.Amount
+	report.NetTax = report.Tax - report.Voids.TaxAmount - report.Refunds.TaxAmount
+
+	return &report, nil
+}
+
+// lastZReportEnd returns when the last closed period ended, or nil if no Z
+// report has been closed yet.
+func lastZReportEnd(db querier) (*time.Time, error) {
+	var end *time.Time
+	err := db.QueryRow(`SELECT MAX(period_end) FROM z_reports`).Scan(&end)
+	return end, err
+}
+
+// GetXReport reports on the open period without closing it.
+func (s *ReportService) GetXReport() (*models.SalesReport, error) {
+	start, err := lastZReportEnd(config.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	var now time.Time
+	if err := config.DB.QueryRow(`SELECT LOCALTIMESTAMP`).Scan(&now); err != nil {
+		return nil, err
+	}
+
+	report, err := buildSalesReport(config.DB, nil, start, now)
+	if err != nil {
+		return nil, err
+	}
+	report.Type = models.ReportTypeX
+	return report, nil
+}
+
+// CloseZReport closes the open period and stores its report. Closed reports
+// are never recalculated.
+func (s *ReportService) CloseZReport(input models.CloseZReportInput) (*models.SalesReport, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Only one close may run at a time, otherwise two reports could cover
+	// the same period
+	if _, err := tx.Exec(`LOCK TABLE z_reports IN EXCLUSIVE MODE`); err != nil {
+		return nil, err
+	}
+
+	start, err := lastZReportEnd(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var now time.Time
+	if err := tx.QueryRow(`SELECT LOCALTIMESTAMP`).Scan(&now); err != nil {
+		return nil, err
+	}
+
+	// Everything committed so far joins this report. Rows committed after
+	// this point, even by transactions that started earlier, stay in the
+	// open period for the next one.
+	var id int
+	if err := tx.QueryRow(`SELECT nextval(pg_get_serial_sequence('z_reports', 'id'))`).Scan(&id); err != nil {
+		return nil, err
+	}
+	for _, update := range []string{
+		`UPDATE invoices SET z_report_id = $1 WHERE z_report_id IS NULL`,
+		`UPDATE payments SET z_report_id = $1 WHERE z_report_id IS NULL`,
+		`UPDATE credit_notes SET z_report_id = $1 WHERE z_report_id IS NULL`,
+		`UPDATE cash_drawers SET z_report_id = $1 WHERE z_report_id IS NULL AND status = 'closed'`,
+	} {
+		if _, err := tx.Exec(update, id); err != nil {
+			return nil, err
+		}
+	}
+
+	report, err := buildSalesReport(tx, &id, start, now)
+	if err != nil {
+		return nil, err
+	}
+	report.Type = models.ReportTypeZ
+	report.ClosedBy = input.ClosedBy
+	report.ID = &id
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO z_reports (id, period_start, period_end, closed_by, report)
+		VALUES ($1, $2, $3, $4, $5)
+	`, id, start, now, input.ClosedBy, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+func (s *ReportService) GetZReports() ([]models.SalesReport, error) {
+	rows, err := config.DB.Query(`
+		SELECT id, report FROM z_reports ORDER BY period_end DESC
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []models.SalesReport{}
+	for rows.Next() {
+		var (
+			id     int
+			data   []byte
+			report models.SalesReport
+		)
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, err
+		}
+		report.ID = &id
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func (s *ReportService) GetZReport(id int) (*models.SalesReport, error) {
+	var data []byte
+	err := config.DB.QueryRow(`SELECT report FROM z_reports WHERE id = $1`, id).Scan(&data)
+	if err != nil {
+		return nil, err
+	}
+
+	var report models.SalesReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	report.ID = &id
+	return &report, nil
+}
+
+// ensurePeriodOpen rejects changes to an invoice whose sale has already been
+// closed into a Z report.
+func ensurePeriodOpen(db querier, invoiceID int) error {
+	var closed bool
+	err := db.QueryRow(`
+		SELECT z_report_id IS NOT NULL FROM invoices WHERE id = $1
+	`, invoiceID).Scan(&closed)
+	if err != nil {
+		return err
+	}
+	if closed {
+		return &ConflictError{Message: "invoice belongs to a period closed by a Z report"}
+	}
+	return nil
+}
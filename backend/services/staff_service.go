@@ -0,0 +1,320 @@
+package services
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"pizza-shop/auth"
+	"pizza-shop/config"
+	"pizza-shop/models"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type StaffService struct{}
+
+const minPasswordLength = 8
+
+// dummyPasswordHash is compared against when a username doesn't exist, so
+// a failed login takes as long whether or not the username is real.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+
+func isRole(role string) bool {
+	for _, known := range models.Roles {
+		if known == role {
+			return true
+		}
+	}
+	return false
+}
+
+func isPIN(pin string) bool {
+	if len(pin) < 4 || len(pin) > 6 {
+		return false
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func hashSecret(secret string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+const staffColumns = `id, username, name, role, pin_hash IS NOT NULL, is_active, created_at`
+
+func scanStaff(row interface{ Scan(...interface{}) error }, staff *models.Staff) error {
+	return row.Scan(
+		&staff.ID,
+		&staff.Username,
+		&staff.Name,
+		&staff.Role,
+		&staff.HasPIN,
+		&staff.IsActive,
+		&staff.CreatedAt,
+	)
+}
+
+// Login checks a username and password and issues a token.
+func (s *StaffService) Login(input models.LoginInput) (*models.Session, error) {
+	var (
+		staff        models.Staff
+		passwordHash string
+	)
+	err := config.DB.QueryRow(`
+		SELECT `+staffColumns+`, password_hash
+		FROM staff
+		WHERE username = $1 AND is_active
+	`, input.Username).Scan(
+		&staff.ID,
+		&staff.Username,
+		&staff.Name,
+		&staff.Role,
+		&staff.HasPIN,
+		&staff.IsActive,
+		&staff.CreatedAt,
+		&passwordHash,
+	)
+	if err == sql.ErrNoRows {
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(input.Password))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(input.Password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return newSession(staff, config.TokenTTL, 0)
+}
+
+// newSession issues a token for staff. tillSessionID ties the token to a
+// till session, or is 0 for a password login.
+func newSession(staff models.Staff, ttl time.Duration, tillSessionID int) (*models.Session, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	token, err := auth.Sign(auth.Claims{
+		Subject:     strconv.Itoa(staff.ID),
+		Name:        staff.Name,
+		Role:        staff.Role,
+		TillSession: tillSessionID,
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   expiresAt.Unix(),
+	}, config.TokenSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Session{Token: token, ExpiresAt: expiresAt, Staff: staff}, nil
+}
+
+// Authenticate returns the active staff member a token was issued to, and
+// their till session for PIN logins. The role is read from the database, so
+// role changes and deactivations apply to tokens already issued. Tokens
+// from PIN logins only work while their till session is active.
+func (s *StaffService) Authenticate(token string) (*models.Staff, *models.TillSession, error) {
+	claims, err := auth.Verify(token, config.TokenSecret, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return nil, nil, auth.ErrInvalidToken
+	}
+
+	staff, err := s.GetStaff(id)
+	if err == sql.ErrNoRows || (err == nil && !staff.IsActive) {
+		return nil, nil, auth.ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if claims.TillSession == 0 {
+		return staff, nil, nil
+	}
+	till, err := touchTillSession(claims.TillSession, staff.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return staff, till, nil
+}
+
+func (s *StaffService) GetAllStaff() ([]models.Staff, error) {
+	rows, err := config.DB.Query(`SELECT ` + staffColumns + ` FROM staff ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	staff := []models.Staff{}
+	for rows.Next() {
+		var member models.Staff
+		if err := scanStaff(rows, &member); err != nil {
+			return nil, err
+		}
+		staff = append(staff, member)
+	}
+
+	return staff, nil
+}
+
+func (s *StaffService) GetStaff(id int) (*models.Staff, error) {
+	var staff models.Staff
+	err := scanStaff(config.DB.QueryRow(`SELECT `+staffColumns+` FROM staff WHERE id = $1`, id), &staff)
+	if err != nil {
+		return nil, err
+	}
+	return &staff, nil
+}
+
+func validateStaff(name, role string, password, pin *string) error {
+	verr := &ValidationError{}
+	if name == "" {
+		verr.Add("name", "must not be empty")
+	}
+	if !isRole(role) {
+		verr.Add("role", "must be one of %v", models.Roles)
+	}
+	if password != nil && len(*password) < minPasswordLength {
+		verr.Add("password", "must be at least %d characters", minPasswordLength)
+	}
+	if pin != nil && *pin != "" && !isPIN(*pin) {
+		verr.Add("pin", "must be 4 to 6 digits")
+	}
+	if verr.HasProblems() {
+		return verr
+	}
+	return nil
+}
+
+func (s *StaffService) CreateStaff(input models.CreateStaffInput) (*models.Staff, error) {
+	if err := validateStaff(input.Name, input.Role, &input.Password, &input.PIN); err != nil {
+		return nil, err
+	}
+
+	passwordHash, err := hashSecret(input.Password)
+	if err != nil {
+		return nil, err
+	}
+	var pinHash *string
+	if input.PIN != "" {
+		hash, err := hashSecret(input.PIN)
+		if err != nil {
+			return nil, err
+		}
+		pinHash = &hash
+	}
+
+	var staff models.Staff
+	err = scanStaff(config.DB.QueryRow(`
+		INSERT INTO staff (username, name, role, password_hash, pin_hash)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+staffColumns,
+		input.Username, input.Name, input.Role, passwordHash, pinHash), &staff)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, &ConflictError{Message: "username " + input.Username + " is already taken"}
+		}
+		return nil, err
+	}
+	return &staff, nil
+}
+
+func (s *StaffService) UpdateStaff(id int, input models.UpdateStaffInput) (*models.Staff, error) {
+	staff, err := s.GetStaff(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Name != nil {
+		staff.Name = *input.Name
+	}
+	if input.Role != nil {
+		staff.Role = *input.Role
+	}
+	if input.IsActive != nil {
+		staff.IsActive = *input.IsActive
+	}
+	if err := validateStaff(staff.Name, staff.Role, input.Password, input.PIN); err != nil {
+		return nil, err
+	}
+
+	// nil leaves a hash unchanged. Setting or removing the PIN also lifts
+	// any PIN lockout.
+	var passwordHash, pinHash *string
+	if input.Password != nil {
+		hash, err := hashSecret(*input.Password)
+		if err != nil {
+			return nil, err
+		}
+		passwordHash = &hash
+	}
+	clearPIN := input.PIN != nil && *input.PIN == ""
+	if input.PIN != nil && !clearPIN {
+		hash, err := hashSecret(*input.PIN)
+		if err != nil {
+			return nil, err
+		}
+		pinHash = &hash
+	}
+
+	err = scanStaff(config.DB.QueryRow(`
+		UPDATE staff
+		SET name = $1, role = $2, is_active = $3,
+		    password_hash = COALESCE($4, password_hash),
+		    pin_hash = CASE WHEN $5 THEN NULL ELSE COALESCE($6, pin_hash) END,
+		    failed_pin_attempts = CASE WHEN $7 THEN 0 ELSE failed_pin_attempts END,
+		    pin_locked_until = CASE WHEN $7 THEN NULL ELSE pin_locked_until END
+		WHERE id = $8
+		RETURNING `+staffColumns,
+		staff.Name, staff.Role, staff.IsActive, passwordHash, clearPIN, pinHash, input.PIN != nil, id), staff)
+	if err != nil {
+		return nil, err
+	}
+	return staff, nil
+}
+
+// publishedAdminPasswords were once shipped as examples and must not be
+// used for the first admin.
+var publishedAdminPasswords = map[string]bool{"change-me-now": true}
+
+// EnsureAdmin creates the first admin account from ADMIN_USERNAME and
+// ADMIN_PASSWORD when there are no staff accounts yet. Without a password
+// nobody could log in, so it is an error.
+func EnsureAdmin() error {
+	var exists bool
+	if err := config.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM staff)`).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	username := config.GetEnv("ADMIN_USERNAME", "admin")
+	password := config.GetEnv("ADMIN_PASSWORD", "")
+	if password == "" || publishedAdminPasswords[password] {
+		return errors.New("no staff accounts exist; set ADMIN_PASSWORD in the environment to create the first admin")
+	}
+
+	service := StaffService{}
+	_, err := service.CreateStaff(models.CreateStaffInput{
+		Username: username,
+		Name:     "Administrator",
+		Role:     models.RoleAdmin,
+		Password: password,
+	})
+	if err == nil {
+		log.Printf("Created admin account %q", username)
+	}
+	return err
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"database/sql"
+	"pizza-shop/config"
+	"pizza-shop/models"
+)
+
+type TaxService struct{}
+
+var itemCategories = map[string]bool{"pizza": true, "beverage": true}
+
+func scanTaxRule(row interface{ Scan(...interface{}) error }, rule *models.TaxRule) error {
+	return row.Scan(
+		&rule.ID,
+		&rule.Name,
+		&rule.Kind,
+		&rule.Rate,
+		&rule.Inclusive,
+		&rule.Category,
+		&rule.IsActive,
+		&rule.CreatedAt,
+	)
+}
+
+func validateTaxRule(name, kind string, rate models.Rate, category *string) error {
+	verr := &ValidationError{}
+	if name == "" {
+		verr.Add("name", "must not be empty")
+	}
+	if kind != models.TaxKindPercentage && kind != models.TaxKindFixed {
+		verr.Add("kind", "must be %q or %q", models.TaxKindPercentage, models.TaxKindFixed)
+	}
+	if rate < 0 {
+		verr.Add("rate", "must not be negative")
+	}
+	if category != nil && !itemCategories[*category] {
+		verr.Add("category", "must be pizza or beverage")
+	}
+	if verr.HasProblems() {
+		return verr
+	}
+	return nil
+}
+
+func (s *TaxService) GetTaxRules() ([]models.TaxRule, error) {
+	var rules []models.TaxRule
+
+	rows, err := config.DB.Query(`
+		SELECT id, name, kind, rate, inclusive, category, is_active, created_at
+		FROM tax_rules
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rule models.TaxRule
+		if err := scanTaxRule(rows, &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func (s *TaxService) CreateTaxRule(input models.CreateTaxRuleInput) (*models.TaxRule, error) {
+	if err := validateTaxRule(input.Name, input.Kind, *input.Rate, input.Category); err != nil {
+		return nil, err
+	}
+
+	isActive := true
+	if input.IsActive != nil {
+		isActive = *input.IsActive
+	}
+
+	var rule models.TaxRule
+	err := scanTaxRule(config.DB.QueryRow(`
+		INSERT INTO tax_rules (name, kind, rate, inclusive, category, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, name, kind, rate, inclusive, category, is_active, created_at
+	`, input.Name, input.Kind, *input.Rate, input.Inclusive, input.Category, isActive), &rule)
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *TaxService) UpdateTaxRule(id int, input models.UpdateTaxRuleInput) (*models.TaxRule, error) {
+	var rule models.TaxRule
+	err := scanTaxRule(config.DB.QueryRow(`
+		SELECT id, name, kind, rate, inclusive, category, is_active, created_at
+		FROM tax_rules WHERE id = $1
+	`, id), &rule)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Name != nil {
+		rule.Name = *input.Name
+	}
+	if input.Kind != nil {
+		rule.Kind = *input.Kind
+	}
+	if input.Rate != nil {
+		rule.Rate = *input.Rate
+	}
+	if input.Inclusive != nil {
+		rule.Inclusive = *input.Inclusive
+	}
+	if input.Category != nil {
+		if *input.Category == "" {
+			rule.Category = nil
+		} else {
+			rule.Category = input.Category
+		}
+	}
+	if input.IsActive != nil {
+		rule.IsActive = *input.IsActive
+	}
+
+	if err := validateTaxRule(rule.Name, rule.Kind, rule.Rate, rule.Category); err != nil {
+		return nil, err
+	}
+
+	err = scanTaxRule(config.DB.QueryRow(`
+		UPDATE tax_rules
+		SET name = $1, kind = $2, rate = $3, inclusive = $4, category = $5, is_active = $6
+		WHERE id = $7
+		RETURNING id, name, kind, rate, inclusive, category, is_active, created_at
+	`, rule.Name, rule.Kind, rule.Rate, rule.Inclusive, rule.Category, rule.IsActive, id), &rule)
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *TaxService) DeleteTaxRule(id int) error {
+	result, err := config.DB.Exec("DELETE FROM tax_rules WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// taxableLine is the part of an invoice line the tax engine needs.
+type taxableLine struct {
+	Category string
+	Amount   models.Money
+}
+
+// calculateTaxes applies every active tax rule to the given lines.
+func calculateTaxes(tx *sql.Tx, lines []taxableLine) ([]models.InvoiceTax, error) {
+	rows, err := tx.Query(`
+		SELECT id, name, kind, rate, inclusive, category, is_active, created_at
+		FROM tax_rules
+		WHERE is_active = true
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.TaxRule
+	for rows.Next() {
+		var rule models.TaxRule
+		if err := scanTaxRule(rows, &rule); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return applyTaxRules(rules, lines), nil
+}
+
+// applyTaxRules works out the tax each rule charges on the given lines.
+// Rules scoped to a category only see lines of that category, and are
+// skipped entirely when there are no such lines.
+func applyTaxRules(rules []models.TaxRule, lines []taxableLine) []models.InvoiceTax {
+	var taxes []models.InvoiceTax
+	for _, rule := range rules {
+		var taxable models.Money
+		applies := false
+		for _, line := range lines {
+			if rule.Category == nil || *rule.Category == line.Category {
+				taxable += line.Amount
+				applies = true
+			}
+		}
+		if !applies {
+			continue
+		}
+
+		ruleID := rule.ID
+		tax := models.InvoiceTax{
+			TaxRuleID:     &ruleID,
+			Name:          rule.Name,
+			Kind:          rule.Kind,
+			Rate:          rule.Rate,
+			Inclusive:     rule.Inclusive,
+			Category:      rule.Category,
+			TaxableAmount: taxable,
+		}
+		switch {
+		case rule.Kind == models.TaxKindFixed:
+			tax.Amount = rule.Rate.Money()
+		case rule.Inclusive:
+			// The taxable amount already contains the tax
+			tax.Amount = taxable.PercentIncluded(rule.Rate)
+		default:
+			tax.Amount = taxable.Percent(rule.Rate)
+		}
+		taxes = append(taxes, tax)
+	}
+
+	return taxes
+}
+
+// invoicePercentageTaxes returns the exclusive percentage taxes an invoice
+// was charged as rules, so part of the invoice can be taxed again the same
+// way whatever the rules say now. Fixed charges are per invoice and
+// inclusive taxes are in the prices, so neither is returned.
+func invoicePercentageTaxes(tx *sql.Tx, invoiceID int) ([]models.TaxRule, error) {
+	rows, err := tx.Query(`
+		SELECT COALESCE(tax_rule_id, 0), name, kind, rate, inclusive, category
+		FROM invoice_taxes
+		WHERE invoice_id = $1 AND kind = 'percentage' AND NOT inclusive
+		ORDER BY id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []models.TaxRule
+	for rows.Next() {
+		var rule models.TaxRule
+		err := rows.Scan(&rule.ID, &rule.Name, &rule.Kind, &rule.Rate, &rule.Inclusive, &rule.Category)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// exclusiveTax totals the taxes charged on top of the line amounts;
+// inclusive taxes are already part of them.
+func exclusiveTax(taxes []models.InvoiceTax) models.Money {
+	var total models.Money
+	for _, tax := range taxes {
+		if !tax.Inclusive {
+			total += tax.Amount
+		}
+	}
+	return total
+}
+
+func getInvoiceTaxes(invoiceID int) ([]models.InvoiceTax, error) {
+	rows, err := config.DB.Query(`
+		SELECT id, invoice_id, tax_rule_id, name, kind, rate, inclusive, category, taxable_amount, amount
+		FROM invoice_taxes
+		WHERE invoice_id = $1
+		ORDER BY id
+	`, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var taxes []models.InvoiceTax
+	for rows.Next() {
+		var tax models.InvoiceTax
+		err := rows.Scan(
+			&tax.ID,
+			&tax.InvoiceID,
+			&tax.TaxRuleID,
+			&tax.Name,
+			&tax.Kind,
+			&tax.Rate,
+			&tax.Inclusive,
+			&tax.Category,
+			&tax.TaxableAmount,
+			&tax.Amount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		taxes = append(taxes, tax)
+	}
+
+	return taxes, nil
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"pizza-shop/models"
+	"testing"
+)
+
+func mustRate(t *testing.T, s string) models.Rate {
+	t.Helper()
+	rate, err := models.ParseRate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rate
+}
+
+func TestApplyTaxRules(t *testing.T) {
+	pizza := "pizza"
+	drinks := "drinks"
+	desserts := "desserts"
+	lines := []taxableLine{
+		{Category: "pizza", Amount: 1299},
+		{Category: "pizza", Amount: 899},
+		{Category: "drinks", Amount: 250},
+	}
+
+	tests := []struct {
+		name          string
+		rule          models.TaxRule
+		wantApplied   bool
+		wantTaxable   models.Money
+		wantAmount    models.Money
+		wantExclusive models.Money
+	}{
+		{
+			name:          "percentage on everything",
+			rule:          models.TaxRule{Kind: models.TaxKindPercentage, Rate: mustRate(t, "8.25")},
+			wantApplied:   true,
+			wantTaxable:   2448,
+			wantAmount:    202, // 201.96
+			wantExclusive: 202,
+		},
+		{
+			name:          "inclusive percentage",
+			rule:          models.TaxRule{Kind: models.TaxKindPercentage, Rate: mustRate(t, "20"), Inclusive: true},
+			wantApplied:   true,
+			wantTaxable:   2448,
+			wantAmount:    408,
+			wantExclusive: 0,
+		},
+		{
+			name:          "scoped to a category",
+			rule:          models.TaxRule{Kind: models.TaxKindPercentage, Rate: mustRate(t, "5"), Category: &pizza},
+			wantApplied:   true,
+			wantTaxable:   2198,
+			wantAmount:    110, // 109.9
+			wantExclusive: 110,
+		},
+		{
+			name:          "fixed charge once per invoice",
+			rule:          models.TaxRule{Kind: models.TaxKindFixed, Rate: mustRate(t, "1.5"), Category: &drinks},
+			wantApplied:   true,
+			wantTaxable:   250,
+			wantAmount:    150,
+			wantExclusive: 150,
+		},
+		{
+			name:        "category with no lines",
+			rule:        models.TaxRule{Kind: models.TaxKindFixed, Rate: mustRate(t, "1"), Category: &desserts},
+			wantApplied: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taxes := applyTaxRules([]models.TaxRule{tt.rule}, lines)
+			if !tt.wantApplied {
+				if len(taxes) != 0 {
+					t.Fatalf("got %d taxes, want none", len(taxes))
+				}
+				return
+			}
+			if len(taxes) != 1 {
+				t.Fatalf("got %d taxes, want 1", len(taxes))
+			}
+			if taxes[0].TaxableAmount != tt.wantTaxable {
+				t.Errorf("taxable = %s, want %s", taxes[0].TaxableAmount, tt.wantTaxable)
+			}
+			if taxes[0].Amount != tt.wantAmount {
+				t.Errorf("amount = %s, want %s", taxes[0].Amount, tt.wantAmount)
+			}
+			if got := exclusiveTax(taxes); got != tt.wantExclusive {
+				t.Errorf("exclusive tax = %s, want %s", got, tt.wantExclusive)
+			}
+		})
+	}
+}
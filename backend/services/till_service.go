@@ -0,0 +1,351 @@
+package services
+
+import (
+	"database/sql"
+	"pizza-shop/config"
+	"pizza-shop/models"
+
+	"github.com/lib/pq"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type TillService struct{}
+
+func (s *TillService) GetTerminals() ([]models.Terminal, error) {
+	rows, err := config.DB.Query(`SELECT id, name, is_active, created_at FROM terminals ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terminals := []models.Terminal{}
+	for rows.Next() {
+		var terminal models.Terminal
+		if err := rows.Scan(&terminal.ID, &terminal.Name, &terminal.IsActive, &terminal.CreatedAt); err != nil {
+			return nil, err
+		}
+		terminals = append(terminals, terminal)
+	}
+
+	return terminals, nil
+}
+
+func (s *TillService) CreateTerminal(input models.CreateTerminalInput) (*models.Terminal, error) {
+	var terminal models.Terminal
+	err := config.DB.QueryRow(`
+		INSERT INTO terminals (name) VALUES ($1)
+		RETURNING id, name, is_active, created_at
+	`, input.Name).Scan(&terminal.ID, &terminal.Name, &terminal.IsActive, &terminal.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return nil, &ConflictError{Message: "terminal " + input.Name + " already exists"}
+		}
+		return nil, err
+	}
+	return &terminal, nil
+}
+
+const tillSessionColumns = `ts.id, ts.terminal_id, t.name, ts.staff_id, s.name, ts.status,
+	ts.opened_at, ts.last_activity_at, ts.locked_at, ts.closed_at`
+
+const tillSessionTables = `till_sessions ts
+	JOIN terminals t ON t.id = ts.terminal_id
+	JOIN staff s ON s.id = ts.staff_id`
+
+func scanTillSession(row interface{ Scan(...interface{}) error }, session *models.TillSession) error {
+	return row.Scan(
+		&session.ID,
+		&session.TerminalID,
+		&session.TerminalName,
+		&session.StaffID,
+		&session.StaffName,
+		&session.Status,
+		&session.OpenedAt,
+		&session.LastActivityAt,
+		&session.LockedAt,
+		&session.ClosedAt,
+	)
+}
+
+// lockIdleTillSessions locks the active sessions that have gone
+// TillIdleTimeout without a request, as of when they went idle.
+func lockIdleTillSessions(q querier) error {
+	_, err := q.Exec(`
+		UPDATE till_sessions
+		SET status = 'locked', locked_at = last_activity_at + $1 * INTERVAL '1 second'
+		WHERE status = 'active' AND last_activity_at <= LOCALTIMESTAMP - $1 * INTERVAL '1 second'
+	`, config.TillIdleTimeout.Seconds())
+	return err
+}
+
+// GetTillSessions lists till sessions, newest first. terminalID 0 and
+// status "" match any.
+func (s *TillService) GetTillSessions(terminalID int, status string) ([]models.TillSession, error) {
+	if err := lockIdleTillSessions(config.DB); err != nil {
+		return nil, err
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT `+tillSessionColumns+`
+		FROM `+tillSessionTables+`
+		WHERE ($1 = 0 OR ts.terminal_id = $1) AND ($2 = '' OR ts.status = $2)
+		ORDER BY ts.opened_at DESC, ts.id DESC
+		LIMIT 200
+	`, terminalID, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []models.TillSession{}
+	for rows.Next() {
+		var session models.TillSession
+		if err := scanTillSession(rows, &session); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+func (s *TillService) GetTillSession(id int) (*models.TillSession, error) {
+	if err := lockIdleTillSessions(config.DB); err != nil {
+		return nil, err
+	}
+	return getTillSession(config.DB, id)
+}
+
+func getTillSession(q querier, id int) (*models.TillSession, error) {
+	var session models.TillSession
+	err := scanTillSession(q.QueryRow(`SELECT `+tillSessionColumns+` FROM `+tillSessionTables+` WHERE ts.id = $1`, id), &session)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// checkPIN returns the active staff member with the username if the PIN is
+// theirs. After PINAttempts wrong PINs in a row their PIN logins are
+// refused for PINLockout.
+//
+// Each attempt is counted as wrong before the PIN is compared, and only
+// forgiven once it matches. The count is taken in one UPDATE, so PINs
+// tried in parallel can't all slip in under the limit.
+func checkPIN(username, pin string) (*models.Staff, error) {
+	var (
+		staff   models.Staff
+		pinHash string
+	)
+	// The count starts again once the lockout begins
+	err := config.DB.QueryRow(`
+		UPDATE staff
+		SET failed_pin_attempts = CASE WHEN failed_pin_attempts + 1 >= $2 THEN 0 ELSE failed_pin_attempts + 1 END,
+		    pin_locked_until = CASE WHEN failed_pin_attempts + 1 >= $2
+		                            THEN LOCALTIMESTAMP + $3 * INTERVAL '1 second' END
+		WHERE username = $1 AND is_active AND pin_hash IS NOT NULL
+		  AND (pin_locked_until IS NULL OR pin_locked_until <= LOCALTIMESTAMP)
+		RETURNING `+staffColumns+`, pin_hash
+	`, username, config.PINAttempts, config.PINLockout.Seconds()).Scan(
+		&staff.ID,
+		&staff.Username,
+		&staff.Name,
+		&staff.Role,
+		&staff.HasPIN,
+		&staff.IsActive,
+		&staff.CreatedAt,
+		&pinHash,
+	)
+	if err == sql.ErrNoRows {
+		// Either locked out, or there is no one with that username and a PIN
+		var lockedOut bool
+		err = config.DB.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM staff
+				WHERE username = $1 AND is_active AND pin_hash IS NOT NULL AND pin_locked_until > LOCALTIMESTAMP
+			)
+		`, username).Scan(&lockedOut)
+		if err != nil {
+			return nil, err
+		}
+		if lockedOut {
+			return nil, ErrPINLockedOut
+		}
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(pin))
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(pinHash), []byte(pin)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	_, err = config.DB.Exec(`UPDATE staff SET failed_pin_attempts = 0, pin_locked_until = NULL WHERE id = $1`, staff.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &staff, nil
+}
+
+// PINLogin clocks a cashier onto a terminal with their PIN, resuming their
+// open session there if they have one. Whoever else was active on the
+// terminal, and the cashier's sessions on other terminals, are locked.
+func (s *TillService) PINLogin(terminalID int, input models.PINLoginInput) (*models.Session, error) {
+	staff, err := checkPIN(input.Username, input.PIN)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Locking the terminal makes cashiers logging onto it take turns
+	var (
+		name     string
+		isActive bool
+	)
+	err = tx.QueryRow(`SELECT name, is_active FROM terminals WHERE id = $1 FOR UPDATE`, terminalID).Scan(&name, &isActive)
+	if err != nil {
+		return nil, err
+	}
+	if !isActive {
+		return nil, &ConflictError{Message: "terminal " + name + " is not in use"}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE till_sessions
+		SET status = 'locked', locked_at = LOCALTIMESTAMP
+		WHERE status = 'active'
+		  AND ((terminal_id = $1 AND staff_id <> $2) OR (terminal_id <> $1 AND staff_id = $2))
+	`, terminalID, staff.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var sessionID int
+	err = tx.QueryRow(`
+		UPDATE till_sessions
+		SET status = 'active', locked_at = NULL, last_activity_at = LOCALTIMESTAMP
+		WHERE terminal_id = $1 AND staff_id = $2 AND status <> 'closed'
+		RETURNING id
+	`, terminalID, staff.ID).Scan(&sessionID)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow(`
+			INSERT INTO till_sessions (terminal_id, staff_id)
+			VALUES ($1, $2)
+			RETURNING id
+		`, terminalID, staff.ID).Scan(&sessionID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	till, err := getTillSession(tx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	session, err := newSession(*staff, config.TokenTTL, till.ID)
+	if err != nil {
+		return nil, err
+	}
+	session.TillSession = till
+	return session, nil
+}
+
+// touchTillSession records activity on the active session a token belongs
+// to. It returns ErrTillSessionLocked if the session is no longer active,
+// including when it has just gone idle.
+func touchTillSession(id, staffID int) (*models.TillSession, error) {
+	var session models.TillSession
+	err := scanTillSession(config.DB.QueryRow(`
+		WITH touched AS (
+			UPDATE till_sessions
+			SET last_activity_at = LOCALTIMESTAMP
+			WHERE id = $1 AND staff_id = $2 AND status = 'active'
+			  AND last_activity_at > LOCALTIMESTAMP - $3 * INTERVAL '1 second'
+			RETURNING *
+		)
+		SELECT `+tillSessionColumns+`
+		FROM touched ts
+		JOIN terminals t ON t.id = ts.terminal_id
+		JOIN staff s ON s.id = ts.staff_id
+	`, id, staffID, config.TillIdleTimeout.Seconds()), &session)
+	if err == sql.ErrNoRows {
+		if err := lockIdleTillSessions(config.DB); err != nil {
+			return nil, err
+		}
+		return nil, ErrTillSessionLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// LockTillSession locks an active session, e.g. when its cashier steps
+// away from the till.
+func (s *TillService) LockTillSession(id int) (*models.TillSession, error) {
+	return setTillSessionStatus(id, `
+		UPDATE till_sessions
+		SET status = 'locked', locked_at = LOCALTIMESTAMP
+		WHERE id = $1 AND status = 'active'
+	`)
+}
+
+// CloseTillSession clocks a cashier off their till. Their cash drawer must
+// have been counted first.
+func (s *TillService) CloseTillSession(id int) (*models.TillSession, error) {
+	return setTillSessionStatus(id, `
+		UPDATE till_sessions
+		SET status = 'closed', closed_at = LOCALTIMESTAMP
+		WHERE id = $1 AND status <> 'closed'
+	`, ensureCashDrawerClosed)
+}
+
+// setTillSessionStatus runs update on a session once the checks pass.
+func setTillSessionStatus(id int, update string, checks ...func(querier, int) error) (*models.TillSession, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockIdleTillSessions(tx); err != nil {
+		return nil, err
+	}
+	session, err := getTillSession(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	for _, check := range checks {
+		if err := check(tx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := tx.Exec(update, id)
+	if err != nil {
+		return nil, err
+	}
+	if changed, err := result.RowsAffected(); err != nil {
+		return nil, err
+	} else if changed == 0 {
+		return nil, &ConflictError{Message: "till session is already " + session.Status}
+	}
+
+	session, err = getTillSession(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	return session, tx.Commit()
+}
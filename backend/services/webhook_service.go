@@ -0,0 +1,477 @@
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"pizza-shop/config"
+	"pizza-shop/events"
+	"pizza-shop/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type WebhookService struct{}
+
+// webhookTopics are the event topics that can be sent to webhooks.
+var webhookTopics = []string{"item", "topping", "invoice"}
+
+const (
+	webhookTimeout     = 10 * time.Second
+	webhookPollEvery   = 5 * time.Second
+	webhookFirstRetry  = 30 * time.Second
+	webhookMaxRetry    = 6 * time.Hour
+	webhookResponseMax = 512 // Bytes of a receiver's response kept as the error
+	webhookWorkers     = 4
+	webhookClaimFor    = time.Minute // How long a delivery being sent is left alone
+)
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// webhookWake nudges a delivery worker when there is new work, so
+// deliveries don't wait for the next poll.
+var webhookWake = make(chan struct{}, 1)
+
+func wakeWebhookWorkers() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+func validateWebhook(rawURL string, eventTypes []string) error {
+	verr := &ValidationError{}
+	if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		verr.Add("url", "must be an http or https URL")
+	}
+
+	allowed := make(map[string]bool)
+	for _, topic := range webhookTopics {
+		allowed[topic] = true
+	}
+	for _, eventType := range events.Types {
+		if allowed[(events.Event{Type: eventType}).Topic()] {
+			allowed[eventType] = true
+		}
+	}
+	for i, eventType := range eventTypes {
+		if !allowed[eventType] {
+			verr.Add(fmt.Sprintf("event_types[%d]", i), "unknown event type %q", eventType)
+		}
+	}
+
+	if verr.HasProblems() {
+		return verr
+	}
+	return nil
+}
+
+func scanWebhookEndpoint(row interface{ Scan(...interface{}) error }, endpoint *models.WebhookEndpoint) error {
+	return row.Scan(
+		&endpoint.ID,
+		&endpoint.URL,
+		pq.Array(&endpoint.EventTypes),
+		&endpoint.IsActive,
+		&endpoint.CreatedAt,
+	)
+}
+
+func (s *WebhookService) GetWebhooks() ([]models.WebhookEndpoint, error) {
+	rows, err := config.DB.Query(`
+		SELECT id, url, event_types, is_active, created_at
+		FROM webhook_endpoints
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []models.WebhookEndpoint{}
+	for rows.Next() {
+		var endpoint models.WebhookEndpoint
+		if err := scanWebhookEndpoint(rows, &endpoint); err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	return endpoints, nil
+}
+
+func (s *WebhookService) CreateWebhook(input models.CreateWebhookInput) (*models.WebhookEndpoint, error) {
+	if input.EventTypes == nil {
+		input.EventTypes = []string{}
+	}
+	if err := validateWebhook(input.URL, input.EventTypes); err != nil {
+		return nil, err
+	}
+
+	secret := input.Secret
+	if secret == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		secret = hex.EncodeToString(key)
+	}
+
+	isActive := true
+	if input.IsActive != nil {
+		isActive = *input.IsActive
+	}
+
+	var endpoint models.WebhookEndpoint
+	err := scanWebhookEndpoint(config.DB.QueryRow(`
+		INSERT INTO webhook_endpoints (url, secret, event_types, is_active)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, url, event_types, is_active, created_at
+	`, input.URL, secret, pq.Array(input.EventTypes), isActive), &endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// The receiver needs the secret to check signatures, and this is the
+	// only time it is shown
+	endpoint.Secret = secret
+	return &endpoint, nil
+}
+
+func (s *WebhookService) UpdateWebhook(id int, input models.UpdateWebhookInput) (*models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+	err := scanWebhookEndpoint(config.DB.QueryRow(`
+		SELECT id, url, event_types, is_active, created_at
+		FROM webhook_endpoints WHERE id = $1
+	`, id), &endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.URL != nil {
+		endpoint.URL = *input.URL
+	}
+	if input.EventTypes != nil {
+		endpoint.EventTypes = input.EventTypes
+	}
+	if input.IsActive != nil {
+		endpoint.IsActive = *input.IsActive
+	}
+	if input.Secret != nil && *input.Secret == "" {
+		verr := &ValidationError{}
+		verr.Add("secret", "must not be empty")
+		return nil, verr
+	}
+	if err := validateWebhook(endpoint.URL, endpoint.EventTypes); err != nil {
+		return nil, err
+	}
+
+	err = scanWebhookEndpoint(config.DB.QueryRow(`
+		UPDATE webhook_endpoints
+		SET url = $1, event_types = $2, is_active = $3, secret = COALESCE($4, secret)
+		WHERE id = $5
+		RETURNING id, url, event_types, is_active, created_at
+	`, endpoint.URL, pq.Array(endpoint.EventTypes), endpoint.IsActive, input.Secret, id), &endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+func (s *WebhookService) DeleteWebhook(id int) error {
+	result, err := config.DB.Exec("DELETE FROM webhook_endpoints WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+const webhookDeliveryColumns = `
+	id, endpoint_id, event_id, event_type, payload, status, attempts,
+	next_attempt_at, last_status_code, COALESCE(last_error, ''), created_at, delivered_at
+`
+
+func scanWebhookDelivery(row interface{ Scan(...interface{}) error }, delivery *models.WebhookDelivery) error {
+	var payload []byte
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.EndpointID,
+		&delivery.EventID,
+		&delivery.EventType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+		&delivery.LastStatusCode,
+		&delivery.LastError,
+		&delivery.CreatedAt,
+		&delivery.DeliveredAt,
+	)
+	delivery.Payload = payload
+	return err
+}
+
+// GetDeliveries lists an endpoint's most recent deliveries, newest first.
+func (s *WebhookService) GetDeliveries(endpointID int, status string, limit int) ([]models.WebhookDelivery, error) {
+	var exists bool
+	err := config.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM webhook_endpoints WHERE id = $1)`, endpointID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	rows, err := config.DB.Query(`
+		SELECT `+webhookDeliveryColumns+`
+		FROM webhook_deliveries
+		WHERE endpoint_id = $1 AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT $3
+	`, endpointID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		if err := scanWebhookDelivery(rows, &delivery); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, nil
+}
+
+// Redeliver sends a delivery again straight away, whatever happened to it
+// before, with a fresh set of attempts. An attempt still in flight loses
+// its claim and its result is dropped.
+func (s *WebhookService) Redeliver(deliveryID int) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := scanWebhookDelivery(config.DB.QueryRow(`
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, claim_seq = claim_seq + 1, next_attempt_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING `+webhookDeliveryColumns, deliveryID), &delivery)
+	if err != nil {
+		return nil, err
+	}
+
+	wakeWebhookWorkers()
+	return &delivery, nil
+}
+
+// StartWebhooks starts sending the deliveries queued when item, topping
+// and invoice changes are committed.
+func StartWebhooks() {
+	for i := 0; i < webhookWorkers; i++ {
+		go deliverWebhooks()
+	}
+}
+
+func isWebhookTopic(eventType string) bool {
+	topic := (events.Event{Type: eventType}).Topic()
+	for _, webhookTopic := range webhookTopics {
+		if topic == webhookTopic {
+			return true
+		}
+	}
+	return false
+}
+
+// queueWebhookEvent saves a delivery of the event for every endpoint that
+// wants it. It runs in the transaction that made the change, so a change
+// is never committed without its deliveries. The event gets its ID from
+// the database so IDs stay unique across restarts.
+func queueWebhookEvent(q querier, event pendingEvent) error {
+	if !isWebhookTopic(event.eventType) {
+		return nil
+	}
+
+	payload, err := json.Marshal(events.Event{Type: event.eventType, Time: event.time, Data: event.data})
+	if err != nil {
+		return err
+	}
+
+	_, err = q.Exec(`
+		WITH event AS (SELECT nextval('webhook_event_id_seq') AS id)
+		INSERT INTO webhook_deliveries (endpoint_id, event_id, event_type, payload)
+		SELECT e.id, event.id, $1, jsonb_set($2::jsonb, '{id}', to_jsonb(event.id))
+		FROM webhook_endpoints e, event
+		WHERE e.is_active AND (cardinality(e.event_types) = 0 OR $1 = ANY(e.event_types) OR $3 = ANY(e.event_types))
+	`, event.eventType, payload, (events.Event{Type: event.eventType}).Topic())
+	return err
+}
+
+func deliverWebhooks() {
+	poll := time.NewTicker(webhookPollEvery)
+	for {
+		for {
+			delivered, err := deliverNextWebhook()
+			if err != nil {
+				log.Printf("Failed to deliver webhook: %v", err)
+			}
+			if !delivered {
+				break
+			}
+		}
+
+		select {
+		case <-poll.C:
+		case <-webhookWake:
+		}
+	}
+}
+
+// deliverNextWebhook makes one attempt at the delivery that has been due
+// longest. It returns false when nothing is due.
+//
+// The delivery is claimed before it is sent: the attempt is counted,
+// claim_seq bumped and next_attempt_at pushed webhookClaimFor ahead, so
+// other workers and servers leave it alone without a transaction being
+// held open while the receiver responds. If the server stops mid-send, the
+// claim lapses and the delivery is tried again.
+func deliverNextWebhook() (bool, error) {
+	var (
+		id, attempts                   int
+		claim                          int64
+		eventType, endpointURL, secret string
+		payload                        []byte
+	)
+	err := config.DB.QueryRow(`
+		UPDATE webhook_deliveries d
+		SET attempts = d.attempts + 1, claim_seq = d.claim_seq + 1,
+		    next_attempt_at = CURRENT_TIMESTAMP + $1 * INTERVAL '1 second'
+		FROM webhook_endpoints e
+		WHERE e.id = d.endpoint_id AND d.id = (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+			ORDER BY next_attempt_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING d.id, d.attempts, d.claim_seq, d.event_type, d.payload, e.url, e.secret
+	`, webhookClaimFor.Seconds()).Scan(&id, &attempts, &claim, &eventType, &payload, &endpointURL, &secret)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	// There may be more due; let another worker pick the next one up
+	// while this one is sent
+	wakeWebhookWorkers()
+
+	statusCode, sendErr := sendWebhook(endpointURL, secret, id, eventType, payload)
+
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+	// Each update only applies while the claim above is the latest, so an
+	// attempt that finishes after the delivery was redelivered or claimed
+	// again can't undo that. attempts alone can't tell them apart, as
+	// Redeliver starts it again from 0.
+	if sendErr == nil {
+		_, err = config.DB.Exec(`
+			UPDATE webhook_deliveries
+			SET status = 'delivered', last_status_code = $1, last_error = NULL,
+			    delivered_at = CURRENT_TIMESTAMP, next_attempt_at = NULL
+			WHERE id = $2 AND claim_seq = $3 AND status = 'pending'
+		`, code, id, claim)
+	} else if attempts >= config.WebhookAttempts {
+		_, err = config.DB.Exec(`
+			UPDATE webhook_deliveries
+			SET status = 'failed', last_status_code = $1, last_error = $2, next_attempt_at = NULL
+			WHERE id = $3 AND claim_seq = $4 AND status = 'pending'
+		`, code, sendErr.Error(), id, claim)
+	} else {
+		_, err = config.DB.Exec(`
+			UPDATE webhook_deliveries
+			SET last_status_code = $1, last_error = $2,
+			    next_attempt_at = CURRENT_TIMESTAMP + $3 * INTERVAL '1 second'
+			WHERE id = $4 AND claim_seq = $5 AND status = 'pending'
+		`, code, sendErr.Error(), webhookRetryDelay(attempts).Seconds(), id, claim)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// webhookRetryDelay doubles the wait after each failed attempt: 30s, 1m,
+// 2m and so on, up to webhookMaxRetry.
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := webhookFirstRetry
+	for i := 1; i < attempts && delay < webhookMaxRetry; i++ {
+		delay *= 2
+	}
+	if delay > webhookMaxRetry {
+		delay = webhookMaxRetry
+	}
+	return delay
+}
+
+// signWebhook returns the X-PizzaPOS-Signature for a payload: the hex
+// HMAC-SHA256 of "<timestamp>.<payload>" keyed with the endpoint's secret.
+func signWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendWebhook posts a payload to a receiver. Any 2xx response counts as
+// delivered.
+func sendWebhook(endpointURL, secret string, deliveryID int, eventType string, payload []byte) (int, error) {
+	request, err := http.NewRequest(http.MethodPost, endpointURL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "PizzaPOS-Webhooks")
+	request.Header.Set("X-PizzaPOS-Event", eventType)
+	request.Header.Set("X-PizzaPOS-Delivery", strconv.Itoa(deliveryID))
+	request.Header.Set("X-PizzaPOS-Timestamp", timestamp)
+	request.Header.Set("X-PizzaPOS-Signature", signWebhook(secret, timestamp, payload))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(response.Body, webhookResponseMax))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("receiver responded %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+	return response.StatusCode, nil
+}
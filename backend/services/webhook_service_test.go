@@ -0,0 +1,330 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"pizza-shop/config"
+	"pizza-shop/events"
+	"pizza-shop/models"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// webhookRequest is what a test receiver saw of one delivery.
+type webhookRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver answers deliveries with the given status codes in turn,
+// repeating the last one, and passes on each request it gets.
+func webhookReceiver(t *testing.T, codes ...int) (*httptest.Server, chan webhookRequest) {
+	t.Helper()
+	requests := make(chan webhookRequest, 10)
+	var served int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- webhookRequest{header: r.Header.Clone(), body: body}
+
+		code := codes[len(codes)-1]
+		if served < len(codes) {
+			code = codes[served]
+		}
+		served++
+		w.WriteHeader(code)
+		io.WriteString(w, http.StatusText(code))
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func receiveWebhook(t *testing.T, requests chan webhookRequest) webhookRequest {
+	t.Helper()
+	select {
+	case request := <-requests:
+		return request
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook was received")
+		return webhookRequest{}
+	}
+}
+
+// checkWebhookSignature checks a request is signed the way the README
+// tells receivers to check it.
+func checkWebhookSignature(t *testing.T, request webhookRequest, secret string) {
+	t.Helper()
+	timestamp := request.header.Get("X-PizzaPOS-Timestamp")
+	if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+		t.Fatalf("bad timestamp %q", timestamp)
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + string(request.body)))
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if got := request.header.Get("X-PizzaPOS-Signature"); !hmac.Equal([]byte(got), []byte(want)) {
+		t.Errorf("signature = %q, want %q", got, want)
+	}
+}
+
+func TestSendWebhook(t *testing.T) {
+	server, requests := webhookReceiver(t, http.StatusNoContent)
+	payload := []byte(`{"id":7,"type":"item.created","data":{"id":1}}`)
+
+	code, err := sendWebhook(server.URL, "s3cret", 42, events.ItemCreated, payload)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("got %d, %v; want 204 and no error", code, err)
+	}
+
+	request := receiveWebhook(t, requests)
+	if string(request.body) != string(payload) {
+		t.Errorf("body = %s, want %s", request.body, payload)
+	}
+	for header, want := range map[string]string{
+		"Content-Type":        "application/json",
+		"X-PizzaPOS-Event":    events.ItemCreated,
+		"X-PizzaPOS-Delivery": "42",
+	} {
+		if got := request.header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	checkWebhookSignature(t, request, "s3cret")
+}
+
+func TestSendWebhookRefused(t *testing.T) {
+	server, _ := webhookReceiver(t, http.StatusServiceUnavailable)
+
+	code, err := sendWebhook(server.URL, "s3cret", 1, events.ItemCreated, []byte(`{}`))
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("code = %d, want 503", code)
+	}
+	if err == nil || !strings.Contains(err.Error(), "Service Unavailable") {
+		t.Errorf("error = %v, want the receiver's response", err)
+	}
+
+	server.Close()
+	if code, err := sendWebhook(server.URL, "s3cret", 1, events.ItemCreated, []byte(`{}`)); err == nil || code != 0 {
+		t.Errorf("got %d, %v from a closed server; want 0 and an error", code, err)
+	}
+}
+
+func TestWebhookRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{5, 8 * time.Minute},
+		{10, 256 * time.Minute},
+		{11, 6 * time.Hour},
+		{50, 6 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		if got := webhookRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("webhookRetryDelay(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+// TestWebhookDelivery follows one event through the outbox: it is queued
+// with its change, retried with backoff when the receiver fails, and sent
+// again on redelivery.
+func TestWebhookDelivery(t *testing.T) {
+	db := useTestDB(t)
+	previousAttempts := config.WebhookAttempts
+	config.WebhookAttempts = 3
+	t.Cleanup(func() { config.WebhookAttempts = previousAttempts })
+
+	server, requests := webhookReceiver(t, http.StatusInternalServerError, http.StatusOK)
+	service := &WebhookService{}
+	endpoint, err := service.CreateWebhook(models.CreateWebhookInput{
+		URL:        server.URL,
+		Secret:     "s3cret",
+		EventTypes: []string{"item"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.DeleteWebhook(endpoint.ID) })
+
+	// Events are only queued when their transaction commits
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rolledBack pendingEvents
+	rolledBack.add(events.ItemDeleted, events.ItemRef{ItemID: -2})
+	for _, event := range rolledBack {
+		if err := queueWebhookEvent(tx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tx.Rollback()
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pending pendingEvents
+	pending.add(events.ItemDeleted, events.ItemRef{ItemID: -1})
+	pending.add(events.InvoiceStatusChanged, events.StatusChange{InvoiceID: -1, From: "open", To: "preparing"})
+	if err := pending.commit(tx); err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err := service.GetDeliveries(endpoint.ID, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].EventType != events.ItemDeleted {
+		t.Fatalf("got %+v, want one item.deleted delivery", deliveries)
+	}
+	delivery := deliveries[0]
+
+	// The receiver fails the first attempt
+	if delivered, err := deliverNextWebhook(); err != nil || !delivered {
+		t.Fatalf("got %v, %v; want an attempt", delivered, err)
+	}
+	request := receiveWebhook(t, requests)
+	checkWebhookSignature(t, request, "s3cret")
+	if got := request.header.Get("X-PizzaPOS-Delivery"); got != strconv.Itoa(delivery.ID) {
+		t.Fatalf("sent delivery %s, want %d", got, delivery.ID)
+	}
+	var event struct {
+		ID   int64          `json:"id"`
+		Type string         `json:"type"`
+		Data events.ItemRef `json:"data"`
+	}
+	if err := json.Unmarshal(request.body, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.ID != delivery.EventID || event.Type != events.ItemDeleted || event.Data.ItemID != -1 {
+		t.Errorf("payload = %s, want event %d", request.body, delivery.EventID)
+	}
+
+	deliveries, err = service.GetDeliveries(endpoint.ID, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	retry := deliveries[0]
+	if retry.Status != "pending" || retry.Attempts != 1 || retry.LastStatusCode == nil || *retry.LastStatusCode != 500 {
+		t.Fatalf("after a failed attempt got %+v", retry)
+	}
+	if retry.NextAttemptAt == nil {
+		t.Fatal("no next attempt was scheduled")
+	}
+	if wait := retry.NextAttemptAt.Sub(retry.CreatedAt); wait < 25*time.Second || wait > time.Minute {
+		t.Errorf("next attempt in %v, want about 30s", wait)
+	}
+
+	// Not due yet, so nothing is sent
+	if delivered, err := deliverNextWebhook(); err != nil || delivered {
+		t.Fatalf("got %v, %v; want nothing due", delivered, err)
+	}
+
+	// Redelivering sends it straight away
+	if _, err := service.Redeliver(delivery.ID); err != nil {
+		t.Fatal(err)
+	}
+	if delivered, err := deliverNextWebhook(); err != nil || !delivered {
+		t.Fatalf("got %v, %v; want a redelivery", delivered, err)
+	}
+	receiveWebhook(t, requests)
+
+	deliveries, err = service.GetDeliveries(endpoint.ID, "delivered", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Attempts != 1 || deliveries[0].DeliveredAt == nil {
+		t.Errorf("after redelivery got %+v, want delivered on its first new attempt", deliveries)
+	}
+}
+
+// TestWebhookStaleAttempt redelivers while an attempt is still waiting on
+// the receiver. The attempt that answers last belongs to the old claim, so
+// its result is dropped.
+func TestWebhookStaleAttempt(t *testing.T) {
+	db := useTestDB(t)
+
+	release := make(chan struct{})
+	requests := make(chan int, 2)
+	var served int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served++
+		n := served
+		requests <- n
+		if n == 1 {
+			<-release
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(server.Close)
+
+	service := &WebhookService{}
+	endpoint, err := service.CreateWebhook(models.CreateWebhookInput{
+		URL:        server.URL,
+		Secret:     "s3cret",
+		EventTypes: []string{"item"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.DeleteWebhook(endpoint.ID) })
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pending pendingEvents
+	pending.add(events.ItemDeleted, events.ItemRef{ItemID: -1})
+	if err := pending.commit(tx); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := service.GetDeliveries(endpoint.ID, "", 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("got %+v, %v; want one delivery", deliveries, err)
+	}
+
+	// The first attempt hangs on the receiver until released
+	stale := make(chan error, 1)
+	go func() {
+		_, err := deliverNextWebhook()
+		stale <- err
+	}()
+	<-requests
+
+	// Redelivered, and the new attempt fails
+	if _, err := service.Redeliver(deliveries[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if delivered, err := deliverNextWebhook(); err != nil || !delivered {
+		t.Fatalf("got %v, %v; want a redelivery", delivered, err)
+	}
+	<-requests
+
+	close(release)
+	if err := <-stale; err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries, err = service.GetDeliveries(endpoint.ID, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := deliveries[0]
+	if got.Status != "pending" || got.Attempts != 1 || got.LastStatusCode == nil || *got.LastStatusCode != 500 {
+		t.Errorf("got %+v, want the redelivery's failure, not the old attempt's success", got)
+	}
+}
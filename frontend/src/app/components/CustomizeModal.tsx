@@ -1,6 +1,7 @@
 // components/CustomizeModal.tsx
 import { useState, useEffect } from 'react';
 import { Topping, SelectedTopping, PizzaWithPrices } from '../types/item';
+import { apiFetch } from '@/lib/api';
 
 interface CustomizeModalProps {
     isOpen: boolean;
@@ -22,7 +23,7 @@ export default function CustomizeModal({
 
     useEffect(() => {
         if (isOpen) {
-            fetch('http://localhost:8080/api/toppings')
+            apiFetch('http://localhost:8080/api/toppings')
                 .then(res => res.json())
                 .then(data => setToppings(data))
                 .catch(err => console.error('Error fetching toppings:', err));
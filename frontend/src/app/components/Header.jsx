@@ -1,9 +1,23 @@
 'use client';
 import Link from 'next/link';
-import { usePathname } from 'next/navigation';
+import { usePathname, useRouter } from 'next/navigation';
+import { useEffect, useState } from 'react';
+import { clearSession, getStaff } from '@/lib/api';
 
 export default function Header() {
   const pathname = usePathname();
+  const router = useRouter();
+  const [staff, setStaff] = useState(null);
+
+  useEffect(() => {
+    setStaff(getStaff());
+  }, [pathname]);
+
+  const handleLogout = () => {
+    clearSession();
+    setStaff(null);
+    router.push('/login');
+  };
 
   const navItems = [
     { href: '/orders', label: 'Shop Orders' },
@@ -33,6 +47,21 @@ export default function Header() {
                 {item.label}
               </Link>
             ))}
+            {staff ? (
+              <button
+                onClick={handleLogout}
+                className="px-3 py-2 rounded-md text-sm font-medium text-[#3A4750] hover:bg-gray-200"
+              >
+                {staff.name} · Log Out
+              </button>
+            ) : (
+              <Link
+                href="/login"
+                className="px-3 py-2 rounded-md text-sm font-medium text-[#3A4750] hover:bg-gray-200"
+              >
+                Log In
+              </Link>
+            )}
           </div>
         </div>
       </nav>
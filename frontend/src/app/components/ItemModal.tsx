@@ -1,6 +1,7 @@
 'use client';
 import { useState, useEffect } from 'react';
 import { Item } from '../types/item';
+import { apiFetch } from '@/lib/api';
 
 interface ItemModalProps {
   isOpen: boolean;
@@ -59,7 +60,7 @@ export default function ItemModal({ isOpen, onClose, onSubmit, editItem }: ItemM
     try {
       console.log('Fetching prices for item:', itemId);
       
-      const response = await fetch(`http://localhost:8080/api/pizzas/${itemId}/prices`, {
+      const response = await apiFetch(`http://localhost:8080/api/pizzas/${itemId}/prices`, {
         method: 'GET',
         headers: {
           'Content-Type': 'application/json',
@@ -166,7 +167,7 @@ export default function ItemModal({ isOpen, onClose, onSubmit, editItem }: ItemM
     formData.append('image', file);
 
     try {
-      const response = await fetch('http://localhost:8080/api/upload', {
+      const response = await apiFetch('http://localhost:8080/api/upload', {
         method: 'POST',
         body: formData,
       });
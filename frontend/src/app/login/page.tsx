@@ -0,0 +1,116 @@
+'use client';
+
+import { useEffect, useState } from 'react'
+import { useRouter } from 'next/navigation'
+import { apiFetch, saveSession } from '@/lib/api'
+
+const TERMINAL_KEY = 'terminal'
+
+export default function Login() {
+  const router = useRouter()
+  const [username, setUsername] = useState('')
+  const [password, setPassword] = useState('')
+  // Cashiers log on to a till with their PIN so their orders record the terminal
+  const [useTill, setUseTill] = useState(true)
+  const [terminal, setTerminal] = useState('')
+  const [pin, setPin] = useState('')
+  const [error, setError] = useState<string | null>(null)
+  const [submitting, setSubmitting] = useState(false)
+
+  // Remember which till this is between logins
+  useEffect(() => {
+    setTerminal(localStorage.getItem(TERMINAL_KEY) ?? '')
+  }, [])
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault()
+    setSubmitting(true)
+    setError(null)
+    try {
+      const response = useTill
+        ? await apiFetch(`http://localhost:8080/api/terminals/${encodeURIComponent(terminal)}/pin-login`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ username, pin }),
+          })
+        : await apiFetch('http://localhost:8080/api/auth/login', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ username, password }),
+          })
+      const data = await response.json()
+      if (!response.ok) {
+        throw new Error(data.error || 'Login failed')
+      }
+      if (useTill) {
+        localStorage.setItem(TERMINAL_KEY, terminal)
+      }
+      saveSession(data.token, data.staff)
+      router.push('/orders')
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'An error occurred')
+    } finally {
+      setSubmitting(false)
+    }
+  }
+
+  return (
+    <main className="min-h-screen flex items-start justify-center pt-32">
+      <form onSubmit={handleSubmit} className="bg-white shadow rounded-lg p-8 w-full max-w-sm space-y-4">
+        <h1 className="text-2xl font-bold text-[#3A4750]">Staff Login</h1>
+        {error && <p className="text-red-500 text-sm">{error}</p>}
+        <input
+          type="text"
+          placeholder="Username"
+          value={username}
+          onChange={(e) => setUsername(e.target.value)}
+          className="w-full border rounded-md px-3 py-2"
+          autoFocus
+          required
+        />
+        {useTill ? (
+          <>
+            <input
+              type="number"
+              placeholder="Terminal number"
+              value={terminal}
+              onChange={(e) => setTerminal(e.target.value)}
+              className="w-full border rounded-md px-3 py-2"
+              min={1}
+              required
+            />
+            <input
+              type="password"
+              inputMode="numeric"
+              placeholder="PIN"
+              value={pin}
+              onChange={(e) => setPin(e.target.value)}
+              className="w-full border rounded-md px-3 py-2"
+              required
+            />
+          </>
+        ) : (
+          <input
+            type="password"
+            placeholder="Password"
+            value={password}
+            onChange={(e) => setPassword(e.target.value)}
+            className="w-full border rounded-md px-3 py-2"
+            required
+          />
+        )}
+        <label className="flex items-center gap-2 text-sm text-gray-600">
+          <input type="checkbox" checked={useTill} onChange={(e) => setUseTill(e.target.checked)} />
+          Log on to a till with my PIN (needed to take orders)
+        </label>
+        <button
+          type="submit"
+          disabled={submitting}
+          className="w-full bg-[#00ADB5] text-white rounded-md py-2 font-medium disabled:opacity-50"
+        >
+          {submitting ? 'Logging in...' : 'Log In'}
+        </button>
+      </form>
+    </main>
+  );
+}
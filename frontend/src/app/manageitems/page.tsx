@@ -2,6 +2,7 @@
 import { useState, useEffect } from 'react';
 import { Item } from '../types/item';
 import ItemModal from '../components/ItemModal';
+import { apiFetch } from '@/lib/api';
 
 export default function ManageItems() {
   const [items, setItems] = useState<Item[]>([]);
@@ -33,7 +34,7 @@ export default function ManageItems() {
 
   const fetchItems = async () => {
     try {
-      const response = await fetch('http://localhost:8080/api/items');
+      const response = await apiFetch('http://localhost:8080/api/items');
       if (!response.ok) {
         throw new Error('Failed to fetch items');
       }
@@ -55,7 +56,7 @@ export default function ManageItems() {
     if (!itemToDelete) return;
 
     try {
-        const response = await fetch(`http://localhost:8080/api/items/${itemToDelete.id}`, {
+        const response = await apiFetch(`http://localhost:8080/api/items/${itemToDelete.id}`, {
             method: 'DELETE',
             headers: {
                 'Content-Type': 'application/json'
@@ -104,7 +105,7 @@ export default function ManageItems() {
 
       console.log('Sending request with body:', requestBody); // Debug log
 
-      const response = await fetch('http://localhost:8080/api/items', {
+      const response = await apiFetch('http://localhost:8080/api/items', {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
@@ -127,7 +128,7 @@ export default function ManageItems() {
           if (!itemData.pizzaPrices[size]) {
             throw new Error(`Price for ${size} size is required for pizzas`);
           }
-          const priceResponse = await fetch('http://localhost:8080/api/pizzaprice', {
+          const priceResponse = await apiFetch('http://localhost:8080/api/pizzaprice', {
             method: 'POST',
             headers: {
               'Content-Type': 'application/json',
@@ -161,7 +162,7 @@ export default function ManageItems() {
     formData.append('image', file);
 
     try {
-      const response = await fetch('http://localhost:8080/api/upload', {
+      const response = await apiFetch('http://localhost:8080/api/upload', {
         method: 'POST',
         body: formData,
       });
@@ -183,7 +184,7 @@ export default function ManageItems() {
   const handleSubmit = async (itemData: any) => {
     if (editItem) {
       // Handle edit
-      const response = await fetch(`http://localhost:8080/api/items/${editItem.id}`, {
+      const response = await apiFetch(`http://localhost:8080/api/items/${editItem.id}`, {
         method: 'PUT',
         headers: {
           'Content-Type': 'application/json',
@@ -202,7 +203,7 @@ export default function ManageItems() {
         
         for (const size of sizes) {
           if (itemData.pizzaPrices[size]) {
-            const priceResponse = await fetch(`http://localhost:8080/api/pizzaprice/${editItem.id}`, {
+            const priceResponse = await apiFetch(`http://localhost:8080/api/pizzaprice/${editItem.id}`, {
               method: 'PUT',
               headers: {
                 'Content-Type': 'application/json',
@@ -6,6 +6,7 @@ import PizzaCard from '../components/PizzaCard'
 import OrderedItemCard from '../components/OrderedItemCard'
 import ReactDOM from 'react-dom/client'
 import PrintReceipt from '../components/PrintReceipt';
+import { apiFetch } from '@/lib/api';
 
 export default function Orders() {
   const [orderNo, setOrderNo] = useState<string>('10000')
@@ -20,7 +21,7 @@ export default function Orders() {
 
   const fetchLatestOrderNo = async () => {
     try {
-      const response = await fetch('http://localhost:8080/api/invoices/latest-order-no')
+      const response = await apiFetch('http://localhost:8080/api/invoices/latest-order-no')
       if (!response.ok) {
         throw new Error('Failed to fetch order number')
       }
@@ -33,8 +34,8 @@ export default function Orders() {
 
   useEffect(() => {
     Promise.all([
-      fetch('http://localhost:8080/api/pizzas-with-prices'),
-      fetch('http://localhost:8080/api/items/beverage'),
+      apiFetch('http://localhost:8080/api/pizzas-with-prices'),
+      apiFetch('http://localhost:8080/api/items/beverage'),
       fetchLatestOrderNo()
     ])
       .then(async ([pizzaRes, beverageRes]) => {
@@ -118,11 +119,10 @@ export default function Orders() {
 
     try {
         const orderData = {
-            order_no: orderNo,
             items: orderedItems.map(item => ({
-                item_name: item.name,
+                item_id: item.itemId,
+                size: item.size,
                 quantity: item.quantity,
-                unit_price: item.unitPrice,
                 toppings: item.toppings?.map(t => ({
                     topping_id: t.id,
                     quantity: t.quantity
@@ -130,7 +130,7 @@ export default function Orders() {
             }))
         };
 
-        const response = await fetch('http://localhost:8080/api/invoices', {
+        const response = await apiFetch('http://localhost:8080/api/invoices', {
             method: 'POST',
             headers: {
                 'Content-Type': 'application/json',
@@ -145,8 +145,8 @@ export default function Orders() {
         // Clear the order items
         setOrderedItems([]);
         
-        // Increment order number
-        setOrderNo(prev => String(Number(prev) + 1));
+        // The server allocates order numbers, so fetch the next one
+        await fetchLatestOrderNo();
 
     } catch (err) {
         console.error('Error placing order:', err);
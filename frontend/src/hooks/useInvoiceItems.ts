@@ -1,5 +1,6 @@
 import { useState, useEffect } from 'react';
 import { InvoiceItem } from '@/types/invoice';
+import { apiFetch } from '@/lib/api';
 
 export default function useInvoiceItems(invoiceId: number | null) {
   const [items, setItems] = useState<InvoiceItem[]>([]);
@@ -12,7 +13,7 @@ export default function useInvoiceItems(invoiceId: number | null) {
     const fetchItems = async () => {
       setLoading(true);
       try {
-        const response = await fetch(`http://localhost:8080/api/invoices/${invoiceId}/items`);
+        const response = await apiFetch(`http://localhost:8080/api/invoices/${invoiceId}/items`);
         if (!response.ok) throw new Error('Failed to fetch invoice items');
         const data = await response.json();
         setItems(data);
@@ -1,5 +1,6 @@
 import { useState, useEffect } from 'react';
 import { Invoice } from '@/types/invoice';
+import { apiFetch } from '@/lib/api';
 
 // Change to default export
 export default function useInvoices() {
@@ -10,10 +11,20 @@ export default function useInvoices() {
   useEffect(() => {
     const fetchInvoices = async () => {
       try {
-        const response = await fetch('http://localhost:8080/api/invoices');
-        if (!response.ok) throw new Error('Failed to fetch invoices');
-        const data = await response.json();
-        setInvoices(data);
+        // The API returns at most 200 invoices a page, so follow
+        // next_cursor until the whole history is loaded
+        const all: Invoice[] = [];
+        let cursor: string | null = null;
+        do {
+          let url = 'http://localhost:8080/api/invoices?limit=200';
+          if (cursor) url += `&cursor=${encodeURIComponent(cursor)}`;
+          const response = await apiFetch(url);
+          if (!response.ok) throw new Error('Failed to fetch invoices');
+          const page: { data: Invoice[]; next_cursor: string | null } = await response.json();
+          all.push(...page.data);
+          cursor = page.next_cursor;
+        } while (cursor);
+        setInvoices(all);
       } catch (err) {
         setError(err instanceof Error ? err.message : 'An error occurred');
       } finally {
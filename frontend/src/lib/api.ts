@@ -0,0 +1,42 @@
+const TOKEN_KEY = 'token';
+const STAFF_KEY = 'staff';
+
+export interface StaffMember {
+  id: number;
+  username: string;
+  name: string;
+  role: 'cashier' | 'kitchen' | 'manager' | 'admin';
+}
+
+export function getStaff(): StaffMember | null {
+  if (typeof window === 'undefined') return null;
+  const stored = localStorage.getItem(STAFF_KEY);
+  return stored ? JSON.parse(stored) : null;
+}
+
+export function saveSession(token: string, staff: StaffMember) {
+  localStorage.setItem(TOKEN_KEY, token);
+  localStorage.setItem(STAFF_KEY, JSON.stringify(staff));
+}
+
+export function clearSession() {
+  localStorage.removeItem(TOKEN_KEY);
+  localStorage.removeItem(STAFF_KEY);
+}
+
+// apiFetch calls the backend with the logged in staff member's token and
+// sends them back to the login page when it is missing or has expired.
+export async function apiFetch(url: string, init: RequestInit = {}) {
+  const headers = new Headers(init.headers);
+  const token = localStorage.getItem(TOKEN_KEY);
+  if (token) {
+    headers.set('Authorization', `Bearer ${token}`);
+  }
+
+  const response = await fetch(url, { ...init, headers });
+  if (response.status === 401 && !url.endsWith('/api/auth/login') && !url.endsWith('/pin-login')) {
+    clearSession();
+    window.location.href = '/login';
+  }
+  return response;
+}